@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"bholtland/studio-one-preset-tool-go/internal/glob"
+	"bholtland/studio-one-preset-tool-go/internal/writer"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	layoutPerSong = "per-song"
+	layoutMerged  = "merged"
+)
+
+type batchResult struct {
+	Song   string
+	Export *songExport
+	Err    error
+}
+
+// runBatch exports every song found below --in-dir, a few songs at a time. A failing song does not stop the others,
+// the error is reported in the summary instead.
+func runBatch(c *cli.Context) error {
+	start := time.Now()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	logger := slog.With("")
+	dryRun := c.Bool("dry-run")
+	outPath := c.String("out-path")
+	layout := c.String("layout")
+
+	if layout != layoutPerSong && layout != layoutMerged {
+		return fmt.Errorf("Unknown layout %q", layout)
+	}
+	if outPath == "" {
+		return errors.New("No output directory set, use --out-path or a profile")
+	}
+	// The number of jobs sizes the semaphore below, it can't wait for newConfig to check it
+	jobs := c.Int("jobs")
+	if jobs < 1 {
+		return fmt.Errorf("No valid number of jobs set: %d", jobs)
+	}
+
+	inDir := filepath.ToSlash(c.String("in-dir"))
+	songs, err := findSongs(inDir, c.StringSlice("song-include"), c.StringSlice("song-exclude"))
+	if err != nil {
+		return fmt.Errorf("Error searching songs: %s", err)
+	}
+	if len(songs) == 0 {
+		return fmt.Errorf("No songs found in %s", inDir)
+	}
+
+	songOutPaths, err := buildSongOutPaths(inDir, songs, outPath, layout)
+	if err != nil {
+		return err
+	}
+
+	// Songs share the output directory in a merged layout, so it can only be cleared once for all of them
+	removeExistingPerSong := c.Bool("remove-existing")
+	if layout == layoutMerged && c.Bool("remove-existing") {
+		removeExistingPerSong = false
+
+		if dryRun {
+			fmt.Printf("Would clear %s\n", outPath)
+		} else if err := os.RemoveAll(outPath); err != nil {
+			return fmt.Errorf("Error cleaning output directory: %s", err)
+		}
+	}
+
+	presetFilter, err := newFilter(c)
+	if err != nil {
+		return err
+	}
+
+	// Songs sharing the output directory plan in the order they were found, so the song that keeps a contested name
+	// doesn't depend on which song was read first
+	var turns *songTurns
+	if layout == layoutMerged {
+		turns = newSongTurns()
+	}
+
+	results := make([]*batchResult, len(songs))
+	sem := make(chan struct{}, jobs)
+
+	var wg sync.WaitGroup
+	for i, song := range songs {
+		wg.Add(1)
+
+		// Taken in order, so the song whose turn it is always runs
+		sem <- struct{}{}
+
+		go func(i int, song string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var waitTurn func()
+			if turns != nil {
+				defer turns.done(i)
+				waitTurn = func() { turns.wait(i) }
+			}
+
+			cfg, err := newConfig(c, song, songOutPaths[song], removeExistingPerSong)
+			if err != nil {
+				results[i] = &batchResult{Song: song, Err: err}
+				return
+			}
+
+			export, err := exportSong(ctx, cfg, logger.With("song", song), exportOptions{
+				DryRun:   dryRun,
+				WaitTurn: waitTurn,
+				LogSkips: !c.Bool("report"),
+				Filter:   presetFilter,
+			})
+
+			results[i] = &batchResult{
+				Song:   song,
+				Export: export,
+				Err:    err,
+			}
+		}(i, song)
+	}
+
+	wg.Wait()
+
+	if dryRun || c.Bool("report") {
+		for _, result := range results {
+			if result.Export == nil {
+				continue
+			}
+
+			fmt.Printf("\n%s\n", result.Song)
+			if dryRun {
+				if err := printPlan(result.Export.Plan, os.Stdout); err != nil {
+					return err
+				}
+			}
+			if c.Bool("report") {
+				if err := printReport(result.Export, "table", os.Stdout); err != nil {
+					return err
+				}
+			}
+		}
+		fmt.Println()
+	}
+
+	if err := printBatchSummary(results, os.Stdout); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d songs failed", failed, len(songs))
+	}
+
+	logger.Info(fmt.Sprintf("Finished %d songs in %s seconds", len(songs), time.Since(start)))
+
+	return nil
+}
+
+// songTurns lets songs plan and write one at a time in the order of their index.
+type songTurns struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	next int
+}
+
+func newSongTurns() *songTurns {
+	t := &songTurns{}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// wait blocks until it is the turn of song i.
+func (t *songTurns) wait(i int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for t.next < i {
+		t.cond.Wait()
+	}
+}
+
+// done ends the turn of song i. A song that failed before its turn still waits for it, so later songs keep their
+// order.
+func (t *songTurns) done(i int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for t.next < i {
+		t.cond.Wait()
+	}
+	t.next = i + 1
+	t.cond.Broadcast()
+}
+
+// findSongs returns every song below dir whose relative path matches the include globs, if any, and none of the
+// exclude globs. Songs are .song and .songtemplate files and extracted song directories. The History folders Studio
+// One keeps next to each song are skipped, use the history command for those.
+func findSongs(dir string, include []string, exclude []string) ([]string, error) {
+	var songs []string
+
+	err := filepath.WalkDir(dir, func(pathname string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if entry.Name() == "History" {
+				return filepath.SkipDir
+			}
+			if pathname == dir {
+				return nil
+			}
+			if _, err := os.Stat(filepath.Join(pathname, filepath.FromSlash(file.SongEntry))); err != nil {
+				return nil
+			}
+		} else if ext := path.Ext(entry.Name()); !strings.EqualFold(ext, ".song") && !strings.EqualFold(ext, ".songtemplate") {
+			return nil
+		}
+
+		// The entries of an extracted song are not songs themselves
+		var done error
+		if entry.IsDir() {
+			done = filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(dir, pathname)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if len(include) > 0 && !glob.MatchAny(include, rel) {
+			return done
+		}
+		if glob.MatchAny(exclude, rel) {
+			return done
+		}
+
+		songs = append(songs, filepath.ToSlash(pathname))
+		return done
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(songs)
+
+	return songs, nil
+}
+
+// buildSongOutPaths decides where the presets of each song go. In the per-song layout every song gets a folder named
+// after it, falling back to its path relative to the input directory when two songs share a name. Folders that would
+// end up inside the folder of another song are refused, as clearing or pruning one song would remove the presets of
+// the other.
+func buildSongOutPaths(inDir string, songs []string, outPath string, layout string) (map[string]string, error) {
+	songOutPaths := make(map[string]string)
+
+	if layout == layoutMerged {
+		for _, song := range songs {
+			songOutPaths[song] = outPath
+		}
+		return songOutPaths, nil
+	}
+
+	names := make(map[string]int)
+	for _, song := range songs {
+		names[songName(song)]++
+	}
+
+	for _, song := range songs {
+		name := songName(song)
+		if names[name] > 1 {
+			rel := strings.TrimPrefix(strings.TrimPrefix(song, inDir), "/")
+			name = path.Join(path.Dir(rel), songName(rel))
+		}
+		songOutPaths[song] = path.Join(outPath, name)
+	}
+
+	// Folders are compared case insensitively, as they are the same folder on Windows and macOS
+	owners := make(map[string]string)
+	for _, song := range songs {
+		owners[strings.ToLower(songOutPaths[song])] = song
+	}
+	for _, song := range songs {
+		for dir := path.Dir(songOutPaths[song]); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if owner, ok := owners[strings.ToLower(dir)]; ok {
+				return nil, fmt.Errorf("The presets of %s would be written inside the folder of %s, exclude one of them or use --layout %s", song, owner, layoutMerged)
+			}
+		}
+	}
+
+	return songOutPaths, nil
+}
+
+// songName strips the extension of song files, extracted songs are named after their directory.
+func songName(song string) string {
+	base := path.Base(song)
+	ext := path.Ext(base)
+	if strings.EqualFold(ext, ".song") || strings.EqualFold(ext, ".songtemplate") {
+		return strings.TrimSuffix(base, ext)
+	}
+	return base
+}
+
+func printBatchSummary(results []*batchResult, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SONG\tSTATUS\tCREATED\tOVERWRITTEN\tUNCHANGED\tSKIPPED\tDELETED\tRENAMED\tERROR")
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(tw, "%s\tfailed\t-\t-\t-\t-\t-\t-\t%s\n", result.Song, result.Err)
+			continue
+		}
+
+		plan := result.Export.Plan
+		fmt.Fprintf(tw, "%s\tok\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			result.Song,
+			plan.Count(writer.ActionCreate),
+			plan.Count(writer.ActionOverwrite),
+			plan.Count(writer.ActionUnchanged),
+			plan.Count(writer.ActionSkip),
+			plan.Count(writer.ActionDelete),
+			len(plan.Collisions),
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// The renames of every song, so a preset that didn't end up where expected can be found
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := false
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		for _, collision := range result.Export.Plan.Collisions {
+			if !header {
+				fmt.Fprintln(tw, "\nSONG\tRENAMED\tTO\tREASON")
+				header = true
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Song, collision.Path, collision.RenamedTo, collision.Reason())
+		}
+	}
+	return tw.Flush()
+}
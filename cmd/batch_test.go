@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBuildSongOutPaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		songs  []string
+		layout string
+		want   map[string]string
+	}{
+		{
+			name:   "per song",
+			songs:  []string{"in/Demo.song", "in/2024/Live.song", "in/Extracted"},
+			layout: layoutPerSong,
+			want: map[string]string{
+				"in/Demo.song":      "out/Demo",
+				"in/2024/Live.song": "out/Live",
+				"in/Extracted":      "out/Extracted",
+			},
+		},
+		{
+			name:   "shared names",
+			songs:  []string{"in/Demo.song", "in/2024/Demo.song"},
+			layout: layoutPerSong,
+			want: map[string]string{
+				"in/Demo.song":      "out/Demo",
+				"in/2024/Demo.song": "out/2024/Demo",
+			},
+		},
+		{
+			name:   "merged",
+			songs:  []string{"in/Demo.song", "in/2024/Demo.song"},
+			layout: layoutMerged,
+			want: map[string]string{
+				"in/Demo.song":      "out",
+				"in/2024/Demo.song": "out",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := buildSongOutPaths("in", test.songs, "out", test.layout)
+			if err != nil {
+				t.Fatalf("buildSongOutPaths returned error: %s", err)
+			}
+			for song, want := range test.want {
+				if got[song] != want {
+					t.Errorf("%s goes to %s, want %s", song, got[song], want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildSongOutPathsNested(t *testing.T) {
+	for _, songs := range [][]string{
+		{"in/a.song", "in/a/x.song", "in/x.song"},
+		{"in/A.song", "in/a/x.song", "in/x.song"},
+	} {
+		if _, err := buildSongOutPaths("in", songs, "out", layoutPerSong); err == nil {
+			t.Errorf("buildSongOutPaths(%q) succeeded, want an error for nested folders", songs)
+		}
+	}
+}
+
+func TestSongTurns(t *testing.T) {
+	turns := newSongTurns()
+
+	var mu sync.Mutex
+	var order []int
+
+	var wg sync.WaitGroup
+	for i := 4; i >= 0; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer turns.done(i)
+
+			// A failing song ends its turn without waiting for it
+			if i == 2 {
+				return
+			}
+
+			turns.wait(i)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	want := []int{0, 1, 3, 4}
+	if len(order) != len(want) {
+		t.Fatalf("Songs took their turn in order %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Songs took their turn in order %v, want %v", order, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"text/tabwriter"
+)
+
+type reportEntry struct {
+	Track  string `json:"track"`
+	Folder string `json:"folder,omitempty"`
+	Device string `json:"device,omitempty"`
+	Output string `json:"output,omitempty"`
+	// RenamedFrom is the path the preset would have had without a name collision
+	RenamedFrom string            `json:"renamedFrom,omitempty"`
+	Action      string            `json:"action,omitempty"`
+	Reason      reader.SkipReason `json:"reason,omitempty"`
+	Detail      string            `json:"detail,omitempty"`
+	Node        string            `json:"node,omitempty"`
+}
+
+var explainCommand = cli.Command{
+	Name:  "explain",
+	Usage: "Print every instrument track in the song with its output path or the reason it was skipped",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Value: "table",
+			Usage: "The output format: table or json",
+		},
+	}, joinFlags(songExportFlags, filterFlags, profileFlags)...),
+	Action: func(c *cli.Context) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		if err := applyProfile(c); err != nil {
+			return err
+		}
+
+		cfg, err := newConfig(c, c.String("in-path"), c.String("out-path"), c.Bool("remove-existing"))
+		if err != nil {
+			return err
+		}
+
+		presetFilter, err := newFilter(c)
+		if err != nil {
+			return err
+		}
+
+		// The output paths come from a dry run, so they account for conflicts in the output directory
+		export, err := exportSong(ctx, cfg, slog.With(""), exportOptions{DryRun: true, Filter: presetFilter})
+		if err != nil {
+			return err
+		}
+
+		return printReport(export, c.String("format"), os.Stdout)
+	},
+}
+
+func buildReport(export *songExport) []reportEntry {
+	var entries []reportEntry
+
+	for _, preset := range export.Presets {
+		entry := reportEntry{
+			Track:  preset.Name,
+			Folder: preset.Path,
+			Device: preset.DeviceName,
+		}
+
+		if action := export.Plan.Find(preset.SongID, ".instrument"); action != nil {
+			entry.Output = action.Path
+			entry.Action = string(action.Kind)
+			entry.RenamedFrom = export.Plan.RenamedFrom(action.Path)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	for _, skip := range export.Skips {
+		entries = append(entries, reportEntry{
+			Track:  skip.TrackName,
+			Device: skip.DeviceName,
+			Reason: skip.Reason,
+			Detail: skip.Description(),
+			Node:   skip.Node,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Folder != entries[j].Folder {
+			return entries[i].Folder < entries[j].Folder
+		}
+		return entries[i].Track < entries[j].Track
+	})
+
+	return entries
+}
+
+func printReport(export *songExport, format string, w io.Writer) error {
+	entries := buildReport(export)
+
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TRACK\tDEVICE\tSTATUS\tOUTPUT OR REASON")
+		for _, entry := range entries {
+			if entry.Reason != "" {
+				fmt.Fprintf(tw, "%s\t%s\tskipped\t%s (%s)\n", entry.Track, entry.Device, entry.Detail, entry.Node)
+				continue
+			}
+			output := entry.Output
+			if entry.RenamedFrom != "" {
+				output = fmt.Sprintf("%s (renamed from %s)", entry.Output, entry.RenamedFrom)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entry.Track, entry.Device, entry.Action, output)
+		}
+		return tw.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	default:
+		return fmt.Errorf("Unknown format %q", format)
+	}
+}
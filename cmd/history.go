@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+type historyEntry struct {
+	Revision int       `json:"revision"`
+	Saved    time.Time `json:"saved"`
+	Size     int64     `json:"size"`
+	Autosave bool      `json:"autosave"`
+	Path     string    `json:"path"`
+}
+
+var historyCommand = cli.Command{
+	Name:      "history",
+	Usage:     "List the earlier saves and autosaves Studio One kept of a song, or export the presets of one of them",
+	ArgsUsage: "[song]",
+	Flags: append([]cli.Flag{
+		&cli.IntFlag{
+			Name:  "revision",
+			Usage: "Export the presets of this revision instead of listing them, 1 is the most recent earlier save",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Value: "table",
+			Usage: "The output format of the list: table or json",
+		},
+	}, joinFlags(songExportFlags, outputFlags, filterFlags, profileFlags)...),
+	Action: func(c *cli.Context) error {
+		if err := applyProfile(c); err != nil {
+			return err
+		}
+
+		inPath := c.String("in-path")
+		if c.NArg() > 0 {
+			inPath = c.Args().First()
+		}
+		if inPath == "" {
+			return errors.New("No song set, use --in-path or pass the song")
+		}
+
+		revisions, err := file.Revisions(inPath)
+		if err != nil {
+			return fmt.Errorf("Error searching revisions: %s", err)
+		}
+
+		if !c.IsSet("revision") {
+			return printHistory(revisions, c.String("format"), os.Stdout)
+		}
+
+		revision := c.Int("revision")
+		if revision < 1 || revision > len(revisions) {
+			return fmt.Errorf("No revision %d of %s, it has %d revisions", revision, filepath.Base(inPath), len(revisions))
+		}
+
+		cfg, err := newConfig(c, revisions[revision-1].Path, c.String("out-path"), c.Bool("remove-existing"))
+		if err != nil {
+			return err
+		}
+		return run(c, cfg)
+	},
+}
+
+func printHistory(revisions []*file.Revision, format string, w io.Writer) error {
+	entries := make([]historyEntry, 0, len(revisions))
+	for i, revision := range revisions {
+		entries = append(entries, historyEntry{
+			Revision: i + 1,
+			Saved:    revision.ModTime,
+			Size:     revision.Size,
+			Autosave: revision.Autosave,
+			Path:     revision.Path,
+		})
+	}
+
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "REVISION\tSAVED\tSIZE\tKIND\tPATH")
+		for _, entry := range entries {
+			kind := "save"
+			if entry.Autosave {
+				kind = "autosave"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\n", entry.Revision, entry.Saved.Format("2006-01-02 15:04:05"), entry.Size, kind, entry.Path)
+		}
+		return tw.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	default:
+		return fmt.Errorf("Unknown format %q", format)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/config"
+	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"bholtland/studio-one-preset-tool-go/internal/song"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type inspectDevice struct {
+	Name        string `json:"name"`
+	Plugin      string `json:"plugin"`
+	ClassID     string `json:"classID"`
+	Category    string `json:"category,omitempty"`
+	SubCategory string `json:"subCategory,omitempty"`
+	PresetFile  string `json:"presetFile"`
+}
+
+type inspectTrack struct {
+	Name        string           `json:"name"`
+	TrackID     string           `json:"trackID"`
+	ChannelID   string           `json:"channelID"`
+	ChannelType string           `json:"channelType,omitempty"`
+	Instrument  *inspectDevice   `json:"instrument,omitempty"`
+	Inserts     []*inspectDevice `json:"inserts,omitempty"`
+}
+
+type inspectFolder struct {
+	Name    string           `json:"name"`
+	TrackID string           `json:"trackID"`
+	Folders []*inspectFolder `json:"folders,omitempty"`
+	Tracks  []*inspectTrack  `json:"tracks,omitempty"`
+}
+
+type inspectSong struct {
+	Version string           `json:"version,omitempty"`
+	Folders []*inspectFolder `json:"folders,omitempty"`
+	Tracks  []*inspectTrack  `json:"tracks,omitempty"`
+}
+
+var inspectCommand = cli.Command{
+	Name:      "inspect",
+	Usage:     "Print the Studio One version of the song and its folder hierarchy with every track, its channel, instrument and inserts",
+	ArgsUsage: "[song]",
+	Flags: append([]cli.Flag{
+		inPathFlag,
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "Print the hierarchy as JSON",
+		},
+	}, profileFlags...),
+	Action: func(c *cli.Context) error {
+		if err := applyProfile(c); err != nil {
+			return err
+		}
+
+		inPath := c.String("in-path")
+		if c.NArg() > 0 {
+			inPath = c.Args().First()
+		}
+
+		cfg, err := config.New(config.Options{InPath: inPath, Jobs: 1})
+		if err != nil {
+			return err
+		}
+		return inspect(cfg, c.Bool("json"), os.Stdout)
+	},
+}
+
+func inspect(cfg *config.Config, asJSON bool, w io.Writer) error {
+	archive, err := openSong(cfg)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	s, skips, err := reader.NewService(cfg, archive).GetSong()
+	if err != nil {
+		return fmt.Errorf("Error parsing: %s", err)
+	}
+
+	skips.Log(slog.Default())
+
+	tree := buildInspectTree(s)
+
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tree)
+	}
+
+	version := tree.Version
+	if version == "" {
+		version = "unknown"
+	}
+	fmt.Fprintf(w, "Saved with: %s\n\n", version)
+
+	printInspectTree(tree.Folders, tree.Tracks, 0, w)
+
+	return nil
+}
+
+// buildInspectTree mirrors the folder hierarchy of the song, the nodes of the walk are attached to the folder one
+// level up.
+func buildInspectTree(s *song.Song) *inspectSong {
+	tree := &inspectSong{}
+	if s.Version != nil {
+		tree.Version = s.Version.String()
+	}
+
+	var parents []*inspectFolder
+
+	s.Walk(func(folder *song.Folder, depth int) bool {
+		node := &inspectFolder{Name: folder.Name, TrackID: folder.ID}
+
+		parents = append(parents[:depth], node)
+		if depth == 0 {
+			tree.Folders = append(tree.Folders, node)
+		} else {
+			parents[depth-1].Folders = append(parents[depth-1].Folders, node)
+		}
+
+		return true
+	}, func(track *song.Track, depth int) {
+		node := buildInspectTrack(track)
+
+		if depth == 0 {
+			tree.Tracks = append(tree.Tracks, node)
+		} else {
+			parents[depth-1].Tracks = append(parents[depth-1].Tracks, node)
+		}
+	})
+
+	return tree
+}
+
+func buildInspectTrack(track *song.Track) *inspectTrack {
+	node := &inspectTrack{
+		Name:      track.Name,
+		TrackID:   track.ID,
+		ChannelID: track.ChannelID,
+	}
+
+	// Instrument tracks play through the output channel of their instrument, audio tracks have their own
+	channel := track.Channel
+	if track.Instrument != nil {
+		node.Instrument = buildInspectDevice(&track.Instrument.Device)
+		channel = track.Instrument.Channel
+	}
+
+	if channel != nil {
+		node.ChannelType = channel.Type
+		for _, insert := range channel.Inserts {
+			node.Inserts = append(node.Inserts, buildInspectDevice(insert))
+		}
+	}
+
+	return node
+}
+
+func buildInspectDevice(device *song.Device) *inspectDevice {
+	return &inspectDevice{
+		Name:        device.Name,
+		Plugin:      device.BaseName,
+		ClassID:     device.ClassID,
+		Category:    device.Category,
+		SubCategory: device.SubCategory,
+		PresetFile:  device.PresetFileName,
+	}
+}
+
+func printInspectTree(folders []*inspectFolder, tracks []*inspectTrack, depth int, w io.Writer) {
+	indent := strings.Repeat("  ", depth)
+
+	for _, folder := range folders {
+		fmt.Fprintf(w, "%s%s/\n", indent, folder.Name)
+		printInspectTree(folder.Folders, folder.Tracks, depth+1, w)
+	}
+
+	for _, track := range tracks {
+		fmt.Fprintf(w, "%s%s  [track %s, channel %s]\n", indent, track.Name, track.TrackID, track.ChannelID)
+		if track.Instrument != nil {
+			fmt.Fprintf(w, "%s    instrument: %s (%s, %s) preset %s\n", indent, track.Instrument.Plugin, track.Instrument.Name, track.Instrument.ClassID, track.Instrument.PresetFile)
+		}
+		for _, insert := range track.Inserts {
+			fmt.Fprintf(w, "%s    insert: %s (%s, %s) preset %s\n", indent, insert.Plugin, insert.Name, insert.ClassID, insert.PresetFile)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/config"
+	"bholtland/studio-one-preset-tool-go/internal/filter"
+	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+type listEntry struct {
+	TrackName      string `json:"trackName"`
+	Path           string `json:"path"`
+	DeviceBaseName string `json:"plugin"`
+	DeviceCategory string `json:"category"`
+	FileName       string `json:"presetFile"`
+}
+
+var listCommand = cli.Command{
+	Name:  "list",
+	Usage: "Print every preset that can be extracted from the song without writing anything",
+	Flags: append([]cli.Flag{
+		inPathFlag,
+		&cli.StringFlag{
+			Name:  "format",
+			Value: "table",
+			Usage: "The output format: table, json or csv",
+		},
+	}, append(filterFlags, profileFlags...)...),
+	Action: func(c *cli.Context) error {
+		if err := applyProfile(c); err != nil {
+			return err
+		}
+
+		presetFilter, err := newFilter(c)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.New(config.Options{InPath: c.String("in-path"), Jobs: 1})
+		if err != nil {
+			return err
+		}
+		return list(cfg, presetFilter, c.String("format"), os.Stdout)
+	},
+}
+
+func list(cfg *config.Config, presetFilter *filter.Filter, format string, w io.Writer) error {
+	song, err := openSong(cfg)
+	if err != nil {
+		return err
+	}
+	defer song.Close()
+
+	presetMap, skips, err := reader.NewService(cfg, song).GetPresets()
+	if err != nil {
+		return fmt.Errorf("Error parsing: %s", err)
+	}
+
+	skips = append(skips, presetFilter.Apply(presetMap)...)
+	skips.Log(slog.Default())
+
+	entries := make([]listEntry, 0, len(presetMap))
+	for _, preset := range presetMap {
+		entries = append(entries, listEntry{
+			TrackName:      preset.Name,
+			Path:           preset.Path,
+			DeviceBaseName: preset.DeviceBaseName,
+			DeviceCategory: preset.DeviceCategory,
+			FileName:       preset.FileName,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].TrackName < entries[j].TrackName
+	})
+
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TRACK\tPATH\tPLUGIN\tCATEGORY\tPRESET FILE")
+		for _, entry := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", entry.TrackName, entry.Path, entry.DeviceBaseName, entry.DeviceCategory, entry.FileName)
+		}
+		return tw.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"track", "path", "plugin", "category", "presetFile"}); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := cw.Write([]string{entry.TrackName, entry.Path, entry.DeviceBaseName, entry.DeviceCategory, entry.FileName}); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("Unknown format %q", format)
+	}
+}
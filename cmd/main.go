@@ -3,43 +3,183 @@ package main
 import (
 	"bholtland/studio-one-preset-tool-go/internal/config"
 	"bholtland/studio-one-preset-tool-go/internal/file"
+	"bholtland/studio-one-preset-tool-go/internal/filter"
 	"bholtland/studio-one-preset-tool-go/internal/reader"
 	"bholtland/studio-one-preset-tool-go/internal/writer"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/urfave/cli"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"runtime"
+	"text/tabwriter"
 	"time"
 )
 
+var inPathFlag = &cli.StringFlag{
+	Name:   "in-path",
+	Usage:  "The path to the song file",
+	EnvVar: "IN_PATH",
+}
+
+// filterFlags select which presets of a song are exported.
+var filterFlags = []cli.Flag{
+	&cli.StringSliceFlag{
+		Name:  "include",
+		Usage: "Only export presets and FX chains matching this filter expression, such as 'path:\"Synths/**\" && plugin:\"Serum\"', can be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "exclude",
+		Usage: "Skip presets and FX chains matching this filter expression, can be repeated",
+	},
+}
+
+// songExportFlags configure the export of a single song, they are shared by every command that writes presets.
+var songExportFlags = []cli.Flag{
+	inPathFlag,
+	&cli.StringFlag{
+		Name:   "out-path",
+		Usage:  "The path to the output directory",
+		EnvVar: "OUT_PATH",
+	},
+	&cli.BoolFlag{
+		Name:   "remove-existing",
+		Usage:  "Whether to remove existing files in the output directory instead of merging into it",
+		EnvVar: "REMOVE_EXISTING",
+	},
+	&cli.StringFlag{
+		Name:   "on-conflict",
+		Value:  "rename",
+		Usage:  "What to do when a file the tool did not generate is in the way of a preset: rename the preset, skip it, overwrite the file or fail",
+		EnvVar: "ON_CONFLICT",
+	},
+	&cli.BoolFlag{
+		Name:   "prune",
+		Usage:  "Whether to remove previously generated presets whose source track no longer exists",
+		EnvVar: "PRUNE",
+	},
+	&cli.StringFlag{
+		Name:   "fx-chains",
+		Value:  "off",
+		Usage:  "How to export the insert FX chain of instrument channels: off, combined or multipreset",
+		EnvVar: "FX_CHAINS",
+	},
+	&cli.BoolFlag{
+		Name:   "channel-fx-chains",
+		Usage:  "Whether to export the insert FX chains of audio tracks, buses and FX channels as standalone FX chains",
+		EnvVar: "CHANNEL_FX_CHAINS",
+	},
+	&cli.IntFlag{
+		Name:   "jobs",
+		Value:  runtime.NumCPU(),
+		Usage:  "The number of presets, and songs from --in-dir, that are processed at the same time",
+		EnvVar: "JOBS",
+	},
+	&cli.StringFlag{
+		Name:   "name-template",
+		Value:  config.DefaultNameTemplate,
+		Usage:  "The Go template the preset file names are built from, such as '{{.DeviceBaseName}} - {{.Name}}'",
+		EnvVar: "NAME_TEMPLATE",
+	},
+	&cli.StringFlag{
+		Name:   "path-template",
+		Value:  config.DefaultPathTemplate,
+		Usage:  "The Go template the folder of each preset is built from, such as '{{.DeviceBaseName}}/{{.Path}}'. Templates can use the fields of a preset and {{.Song}}",
+		EnvVar: "PATH_TEMPLATE",
+	},
+	&cli.BoolFlag{
+		Name:   "ascii-names",
+		Usage:  "Whether to transliterate file and folder names to plain ASCII, such as Füße to Fusse",
+		EnvVar: "ASCII_NAMES",
+	},
+	&cli.StringFlag{
+		Name:   "creator",
+		Value:  config.DefaultCreator,
+		Usage:  "The creator stored in the metadata of every preset",
+		EnvVar: "CREATOR",
+	},
+}
+
+// batchFlags select the songs exported from a directory.
+var batchFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:   "in-dir",
+		Usage:  "A directory to search for songs, exporting every song found instead of --in-path",
+		EnvVar: "IN_DIR",
+	},
+	&cli.StringSliceFlag{
+		Name:  "song-include",
+		Usage: "Only export songs whose path relative to --in-dir matches this glob, can be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "song-exclude",
+		Usage: "Skip songs whose path relative to --in-dir matches this glob, can be repeated",
+	},
+	&cli.StringFlag{
+		Name:   "layout",
+		Value:  "per-song",
+		Usage:  "How songs from --in-dir are laid out in the output directory: per-song or merged",
+		EnvVar: "LAYOUT",
+	},
+}
+
+// outputFlags print what an export did or would do.
+var outputFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "report",
+		Usage: "Print every instrument track with its output path or the reason it was skipped",
+	},
+	&cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print the planned changes to the output directory without writing anything",
+	},
+}
+
+// exportFlags configure the whole export pipeline, for one song or a directory of songs.
+var exportFlags = joinFlags(songExportFlags, batchFlags, outputFlags, filterFlags, profileFlags)
+
+// joinFlags joins groups of flags into a new slice, so the groups themselves are never appended to.
+func joinFlags(groups ...[]cli.Flag) []cli.Flag {
+	var joined []cli.Flag
+	for _, group := range groups {
+		joined = append(joined, group...)
+	}
+	return joined
+}
+
 func main() {
 	app := &cli.App{
 		Name:  "greet",
 		Usage: "say a greeting",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:   "in-path",
-				Value:  "C:/Users/Berend/Nextcloud/Studio One/Songs/Instrument Exploration/Instrument Exploration.song",
-				Usage:  "The path to the song file",
-				EnvVar: "IN_PATH",
-			},
-			&cli.StringFlag{
-				Name:   "out-path",
-				Value:  "C:/Users/Berend/Documents/Studio One Autogenerated Presets",
-				Usage:  "The path to the output directory",
-				EnvVar: "OUT_PATH",
-			},
-			&cli.BoolFlag{
-				Name:   "remove-existing",
-				Usage:  "Whether to remove existing files in the output directory",
-				EnvVar: "REMOVE_EXISTING",
-			},
-		},
+		Flags: exportFlags,
 		Action: func(c *cli.Context) error {
-			cfg := config.New(c.String("in-path"), c.String("out-path"), c.Bool("remove-existing"))
+			if err := applyProfile(c); err != nil {
+				return err
+			}
+
+			if c.String("in-dir") != "" {
+				return runBatch(c)
+			}
+
+			cfg, err := newConfig(c, c.String("in-path"), c.String("out-path"), c.Bool("remove-existing"))
+			if err != nil {
+				return err
+			}
 			return run(c, cfg)
 		},
+		Commands: []cli.Command{
+			listCommand,
+			inspectCommand,
+			explainCommand,
+			watchCommand,
+			historyCommand,
+			validateCommand,
+			unpackCommand,
+			packCommand,
+		},
 	}
 
 	err := app.Run(os.Args)
@@ -49,37 +189,210 @@ func main() {
 	}
 }
 
+// newConfig builds the configuration of an export from the flags, the paths are passed separately as they differ
+// per song for --in-dir.
+func newConfig(c *cli.Context, inPath string, outPath string, removeExistingOut bool) (*config.Config, error) {
+	if inPath == "" {
+		return nil, errors.New("No song set, use --in-path, --in-dir or a profile")
+	}
+	if outPath == "" {
+		return nil, errors.New("No output directory set, use --out-path or a profile")
+	}
+
+	return config.New(config.Options{
+		InPath:            inPath,
+		OutPath:           outPath,
+		RemoveExistingOut: removeExistingOut,
+		FXChainMode:       c.String("fx-chains"),
+		ChannelFXChains:   c.Bool("channel-fx-chains"),
+		OnConflict:        c.String("on-conflict"),
+		Prune:             c.Bool("prune"),
+		Jobs:              c.Int("jobs"),
+		NameTemplate:      c.String("name-template"),
+		PathTemplate:      c.String("path-template"),
+		ASCIINames:        c.Bool("ascii-names"),
+		Creator:           c.String("creator"),
+	})
+}
+
+func newFilter(c *cli.Context) (*filter.Filter, error) {
+	return filter.New(c.StringSlice("include"), c.StringSlice("exclude"))
+}
+
 func run(cliCtx *cli.Context, cfg *config.Config) error {
 	start := time.Now()
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	logger := slog.With("")
 
-	if err := os.RemoveAll(cfg.Temp.Path); err != nil {
-		return fmt.Errorf("Error cleaning up: %s", err)
+	presetFilter, err := newFilter(cliCtx)
+	if err != nil {
+		return err
+	}
+
+	export, err := exportSong(ctx, cfg, logger, exportOptions{
+		DryRun:   cliCtx.Bool("dry-run"),
+		LogSkips: !cliCtx.Bool("report"),
+		Filter:   presetFilter,
+	})
+	if err != nil {
+		return err
+	}
+
+	if cliCtx.Bool("dry-run") {
+		if err := printPlan(export.Plan, os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if cliCtx.Bool("report") {
+		if err := printReport(export, "table", os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if cliCtx.Bool("dry-run") {
+		return nil
+	}
+
+	logger.Info(fmt.Sprintf("Finished in %s seconds", time.Since(start)))
+
+	return nil
+}
+
+type exportOptions struct {
+	// DryRun returns the plan without applying it
+	DryRun bool
+	// WaitTurn is called once the packages are built and returns once the song may plan and write, so songs sharing
+	// an output directory don't pick the same paths. Nil plans right away
+	WaitTurn func()
+	// LogSkips logs why tracks were skipped, leave it off when the skips are reported in another way
+	LogSkips bool
+	// Filter selects the presets to export, nil exports all of them
+	Filter *filter.Filter
+}
+
+type songExport struct {
+	Plan    *writer.Plan
+	Presets reader.PresetMap
+	Skips   reader.Skips
+}
+
+// exportSong runs the whole pipeline for one song.
+func exportSong(ctx context.Context, cfg *config.Config, logger *slog.Logger, opts exportOptions) (*songExport, error) {
+	song, err := openSong(cfg)
+	if err != nil {
+		return nil, err
 	}
+	defer song.Close()
 
-	defer os.RemoveAll(cfg.Temp.Path)
+	readerSvc := reader.NewService(cfg, song)
+	writerSvc := writer.NewService(cfg, ctx, logger, song)
 
-	readerSvc := reader.NewService(cfg)
-	writerSvc := writer.NewService(cfg, ctx, logger)
+	presetMap, skips, err := readerSvc.GetPresets()
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing: %s", err)
+	}
+
+	skips = append(skips, opts.Filter.Apply(presetMap)...)
+
+	var fxChainMap *reader.FXChainMap
+	if cfg.ChannelFXChains {
+		channelFXChains, fxChainSkips, err := readerSvc.GetFXChains()
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing FX chains: %s", err)
+		}
+		fxChainMap = &channelFXChains
+		skips = append(skips, fxChainSkips...)
+		skips = append(skips, opts.Filter.ApplyFXChains(channelFXChains)...)
+	}
 
-	err := file.Extract(ctx, cfg.In.Full, cfg.Temp.SongContentsPath)
+	if opts.LogSkips {
+		skips.Log(logger)
+	}
+
+	build, err := writerSvc.Build(&presetMap, fxChainMap)
 	if err != nil {
-		return fmt.Errorf("Error extracting project: %s", err)
+		return nil, fmt.Errorf("Error planning presets: %s", err)
+	}
+
+	if opts.WaitTurn != nil {
+		opts.WaitTurn()
 	}
 
-	presetMap, err := readerSvc.GetPresets()
+	plan, err := writerSvc.PlanBuild(build)
 	if err != nil {
-		return fmt.Errorf("Error parsing: %s", err)
+		return nil, fmt.Errorf("Error planning presets: %s", err)
 	}
 
-	err = writerSvc.CreatePresets(&presetMap)
+	export := &songExport{
+		Plan:    plan,
+		Presets: presetMap,
+		Skips:   skips,
+	}
+
+	if opts.DryRun {
+		return export, nil
+	}
+
+	if err := writerSvc.Apply(plan); err != nil {
+		return nil, fmt.Errorf("Error writing presets: %s", err)
+	}
+
+	return export, nil
+}
+
+// openSong opens the song archive for random access, so only the entries that are needed are read. Extracted songs are
+// read from the directory.
+func openSong(cfg *config.Config) (file.SongFS, error) {
+	song, err := file.OpenSong(cfg.In.Full)
 	if err != nil {
-		return fmt.Errorf("Error writing presets: %s", err)
+		return nil, fmt.Errorf("Error opening project: %s", err)
 	}
 
-	logger.Info(fmt.Sprintf("Finished in %s seconds", time.Since(start)))
+	return song, nil
+}
 
-	return nil
+func printPlan(plan *writer.Plan, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tPATH\tSIZE\tCONTENT")
+	for _, action := range plan.Actions {
+		content := "new"
+		switch action.Kind {
+		case writer.ActionSkip:
+			content = "kept"
+		case writer.ActionUnchanged:
+			content = "unchanged"
+		case writer.ActionOverwrite:
+			content = "unchanged"
+			if action.Differs {
+				content = "changed"
+			}
+		case writer.ActionDelete:
+			content = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", action.Kind, action.Path, action.Size, content)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	return printCollisions(plan.Collisions, w)
+}
+
+// printCollisions lists the presets that were given a numbered name, with the path they would have had.
+func printCollisions(collisions []*writer.Collision, w io.Writer) error {
+	if len(collisions) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RENAMED\tTO\tREASON")
+	for _, collision := range collisions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", collision.Path, collision.RenamedTo, collision.Reason())
+	}
+	return tw.Flush()
 }
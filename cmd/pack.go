@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/instrument"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"os"
+)
+
+var unpackCommand = cli.Command{
+	Name:      "unpack",
+	Usage:     "Extract a preset package into a directory for editing it by hand",
+	ArgsUsage: "<package> <dir>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			return errors.New("Pass the package to unpack and the directory to unpack it to")
+		}
+
+		if err := instrument.Unpack(c.Args().Get(0), c.Args().Get(1)); err != nil {
+			return fmt.Errorf("Error unpacking: %s", err)
+		}
+
+		fmt.Printf("Unpacked %s to %s\n", c.Args().Get(0), c.Args().Get(1))
+		return nil
+	},
+}
+
+var packCommand = cli.Command{
+	Name:      "pack",
+	Usage:     "Rebuild a preset package from a directory made with unpack, regenerating its presetparts.xml",
+	ArgsUsage: "<dir> <package>",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			return errors.New("Pass the directory to pack and the package to write")
+		}
+
+		report, err := instrument.Pack(context.Background(), c.Args().Get(0), c.Args().Get(1))
+		if errors.Is(err, instrument.ErrInvalidPackage) {
+			if err := printValidation([]*instrument.Report{report}, "table", os.Stdout); err != nil {
+				return err
+			}
+			return fmt.Errorf("Error packing: %s", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Error packing: %s", err)
+		}
+
+		fmt.Printf("Packed %s to %s\n", c.Args().Get(0), c.Args().Get(1))
+		return nil
+	},
+}
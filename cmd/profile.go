@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/config"
+	"fmt"
+	"github.com/urfave/cli"
+	"sort"
+)
+
+// profileFlags select the configuration profile the other flags default to.
+var profileFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:   "config",
+		Usage:  "The configuration file to read profiles from, instead of the user-level config.yaml and " + config.FileName,
+		EnvVar: "CONFIG",
+	},
+	&cli.StringFlag{
+		Name:   "profile",
+		Usage:  "The profile of the configuration file to use, the default profile of the file if not set",
+		EnvVar: "PROFILE",
+	},
+}
+
+// applyProfile fills in the flags of the command from the selected profile. Flags set on the command line or through
+// their environment variable take precedence. Settings for flags of other commands are ignored, settings that are no
+// flag of any command are refused.
+func applyProfile(c *cli.Context) error {
+	paths := config.DefaultPaths()
+	required := false
+	if c.String("config") != "" {
+		paths = []string{c.String("config")}
+		required = true
+	}
+
+	file, err := config.LoadFiles(paths, required)
+	if err != nil {
+		return err
+	}
+
+	profile, err := file.Profile(c.String("profile"))
+	if err != nil {
+		return err
+	}
+
+	// The flags of the app itself when no command is run
+	flags := c.Command.Flags
+	if c.Command.Name == "" {
+		flags = c.App.Flags
+	}
+
+	defined := make(map[string]bool)
+	for _, flag := range flags {
+		defined[flag.GetName()] = true
+	}
+
+	// Profiles can set the flags of every command, such as format or debounce, so one profile serves all of them
+	settings := make(map[string]bool)
+	for _, flag := range c.App.Flags {
+		settings[flag.GetName()] = true
+	}
+	for _, command := range c.App.Commands {
+		for _, flag := range command.Flags {
+			settings[flag.GetName()] = true
+		}
+	}
+	for _, flag := range profileFlags {
+		delete(settings, flag.GetName())
+	}
+
+	keys := make([]string, 0, len(profile))
+	for key := range profile {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !settings[key] {
+			return fmt.Errorf("Unknown setting %q in profile", key)
+		}
+
+		if !defined[key] || c.IsSet(key) {
+			continue
+		}
+
+		values, err := profile.Values(key)
+		if err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			if err := c.Set(key, value); err != nil {
+				return fmt.Errorf("Invalid value %q for setting %q in profile: %s", value, key, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/instrument"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// packageExts are the extensions of the preset packages validate looks for in directories.
+var packageExts = []string{".instrument", ".multipreset"}
+
+var validateCommand = cli.Command{
+	Name:      "validate",
+	Usage:     "Check that .instrument and .multipreset packages can be loaded by Studio One",
+	ArgsUsage: "<file-or-dir>...",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Value: "table",
+			Usage: "The output format: table or json",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() == 0 {
+			return errors.New("No package set, pass the files or directories to validate")
+		}
+
+		var paths []string
+		for _, arg := range c.Args() {
+			found, err := findPackages(arg)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, found...)
+		}
+
+		reports := make([]*instrument.Report, 0, len(paths))
+		for _, filePath := range paths {
+			reports = append(reports, instrument.Validate(filePath))
+		}
+
+		if err := printValidation(reports, c.String("format"), os.Stdout); err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, report := range reports {
+			if !report.Valid {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d packages failed validation", failed, len(reports))
+		}
+
+		return nil
+	},
+}
+
+// findPackages returns the path itself for files, whatever their extension, and every package below it for
+// directories.
+func findPackages(root string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+
+	var paths []string
+	err = filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		for _, ext := range packageExts {
+			if strings.EqualFold(filepath.Ext(entry.Name()), ext) {
+				paths = append(paths, filePath)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error searching packages: %s", err)
+	}
+
+	return paths, nil
+}
+
+func printValidation(reports []*instrument.Report, format string, w io.Writer) error {
+	switch format {
+	case "table":
+		for _, report := range reports {
+			if report.Valid {
+				fmt.Fprintf(w, "PASS  %s\n", report.Path)
+				continue
+			}
+
+			fmt.Fprintf(w, "FAIL  %s\n", report.Path)
+			for _, check := range report.Failed() {
+				fmt.Fprintf(w, "      %s: %s\n", check.Name, check.Message)
+			}
+		}
+		return nil
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	default:
+		return fmt.Errorf("Unknown format %q", format)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+)
+
+type watchedSong struct {
+	modTime   time.Time
+	size      int64
+	changedAt time.Time
+	pending   bool
+}
+
+var watchCommand = cli.Command{
+	Name:  "watch",
+	Usage: "Re-export the presets of a song, or every song in --in-dir, each time it is saved",
+	Flags: append([]cli.Flag{
+		&cli.DurationFlag{
+			Name:  "debounce",
+			Value: 2 * time.Second,
+			Usage: "How long a song has to be left alone after a change before it is exported",
+		},
+		&cli.DurationFlag{
+			Name:  "poll-interval",
+			Value: 500 * time.Millisecond,
+			Usage: "How often songs are checked for changes",
+		},
+	}, exportFlags...),
+	Action: func(c *cli.Context) error {
+		return watch(c)
+	},
+}
+
+// watch polls the songs for changes until interrupted. A changed song is exported once it has not changed for the
+// debounce period and its archive is complete.
+func watch(c *cli.Context) error {
+	if err := applyProfile(c); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	logger := slog.With("")
+	debounce := c.Duration("debounce")
+	outPath := c.String("out-path")
+	layout := c.String("layout")
+	inDir := filepath.ToSlash(c.String("in-dir"))
+
+	if layout != layoutPerSong && layout != layoutMerged {
+		return fmt.Errorf("Unknown layout %q", layout)
+	}
+	if inDir == "" && c.String("in-path") == "" {
+		return errors.New("No song set, use --in-path, --in-dir or a profile")
+	}
+	if outPath == "" {
+		return errors.New("No output directory set, use --out-path or a profile")
+	}
+
+	// Every export of a merged layout would clear the presets of the other songs
+	removeExisting := c.Bool("remove-existing")
+	if inDir != "" && layout == layoutMerged && removeExisting {
+		logger.Warn("Ignoring --remove-existing for a merged layout in watch mode")
+		removeExisting = false
+	}
+
+	presetFilter, err := newFilter(c)
+	if err != nil {
+		return err
+	}
+
+	songs := make(map[string]*watchedSong)
+
+	ticker := time.NewTicker(c.Duration("poll-interval"))
+	defer ticker.Stop()
+
+	logger.Info("Watching for changes, press Ctrl-C to stop")
+
+	// waiting is set while the directory has no songs, to log that only once
+	waiting := false
+
+	for {
+		paths := []string{c.String("in-path")}
+		if inDir != "" {
+			found, err := findSongs(inDir, c.StringSlice("song-include"), c.StringSlice("song-exclude"))
+			if err != nil {
+				return fmt.Errorf("Error searching songs: %s", err)
+			}
+			paths = found
+
+			if len(paths) == 0 && !waiting {
+				logger.Info("No songs found, waiting for songs to be added", "dir", inDir)
+			}
+			waiting = len(paths) == 0
+		}
+
+		var songOutPaths map[string]string
+		if inDir != "" {
+			songOutPaths, err = buildSongOutPaths(inDir, paths, outPath, layout)
+			if err != nil {
+				return err
+			}
+		} else {
+			songOutPaths = map[string]string{paths[0]: outPath}
+		}
+
+		now := time.Now()
+
+		for _, song := range paths {
+			info, err := os.Stat(song)
+			if err == nil && info.IsDir() {
+				// An extracted song changes when its song.xml is rewritten
+				info, err = os.Stat(filepath.Join(song, filepath.FromSlash(file.SongEntry)))
+			}
+			if err != nil {
+				// The song may be replaced while saving, try again on the next tick
+				continue
+			}
+
+			state, ok := songs[song]
+			if !ok {
+				// Songs are exported once when they are first seen
+				state = &watchedSong{pending: true}
+				songs[song] = state
+			}
+
+			if !info.ModTime().Equal(state.modTime) || info.Size() != state.size {
+				state.modTime = info.ModTime()
+				state.size = info.Size()
+				state.changedAt = now
+				state.pending = true
+			}
+
+			if !state.pending || now.Sub(state.changedAt) < debounce {
+				continue
+			}
+
+			if _, err := file.DetectSong(song); err != nil {
+				logger.Debug("Song is not complete yet", "song", song, "error", err)
+				continue
+			}
+
+			state.pending = false
+
+			start := time.Now()
+			cfg, err := newConfig(c, song, songOutPaths[song], removeExisting)
+			if err != nil {
+				return err
+			}
+
+			export, err := exportSong(ctx, cfg, logger.With("song", song), exportOptions{
+				DryRun:   c.Bool("dry-run"),
+				LogSkips: !c.Bool("report"),
+				Filter:   presetFilter,
+			})
+			if err != nil {
+				logger.Error("Error exporting song", "song", song, "error", err)
+				continue
+			}
+
+			if c.Bool("dry-run") {
+				if err := printPlan(export.Plan, os.Stdout); err != nil {
+					return err
+				}
+			}
+
+			if c.Bool("report") {
+				if err := printReport(export, "table", os.Stdout); err != nil {
+					return err
+				}
+			}
+
+			if c.Bool("dry-run") {
+				continue
+			}
+
+			logger.Info(fmt.Sprintf("Exported %s in %s seconds", song, time.Since(start)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,14 +2,12 @@ module bholtland/studio-one-preset-tool-go
 
 go 1.22.1
 
-require github.com/urfave/cli v1.22.14
+require (
+	github.com/urfave/cli v1.22.14
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
-	github.com/klauspost/compress v1.16.5 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
-	github.com/saracen/fastzip v0.1.11 // indirect
-	github.com/saracen/zipextra v0.0.0-20220303013732-0187cb0159ea // indirect
-	golang.org/x/sync v0.2.0 // indirect
-	golang.org/x/sys v0.8.0 // indirect
 )
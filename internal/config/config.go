@@ -1,62 +1,175 @@
 package config
 
 import (
-	"os"
-	"path"
-	"regexp"
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
 )
 
 type in struct {
 	Path     string
 	FileName string
 	Full     string
+	// Name is the name of the song, the file name without its extension
+	Name string
+	Kind file.SongKind
 }
 
 type out struct {
 	Path string
 }
 
-type temp struct {
-	Path                   string
-	SongContentsPath       string
-	PresetConstructionPath string
-}
+type FXChainMode string
+
+const (
+	FXChainModeOff         FXChainMode = "off"
+	FXChainModeCombined    FXChainMode = "combined"
+	FXChainModeMultipreset FXChainMode = "multipreset"
+)
+
+type ConflictPolicy string
+
+const (
+	ConflictPolicySkip      ConflictPolicy = "skip"
+	ConflictPolicyOverwrite ConflictPolicy = "overwrite"
+	ConflictPolicyRename    ConflictPolicy = "rename"
+	ConflictPolicyFail      ConflictPolicy = "fail"
+)
 
 type Config struct {
 	In                in
 	Out               out
-	Temp              temp
 	RemoveExistingOut bool
+	FXChainMode       FXChainMode
+	ChannelFXChains   bool
+	OnConflict        ConflictPolicy
+	Prune             bool
+	Jobs              int
+	// NameTemplate and PathTemplate are executed with a preset to name its package and the folder it goes in
+	NameTemplate *template.Template
+	PathTemplate *template.Template
+	// ASCIINames transliterates file and folder names to ASCII
+	ASCIINames bool
+	// Creator is stored as the Document:Creator of every package
+	Creator string
+}
+
+const (
+	DefaultNameTemplate = "{{.Name}}"
+	DefaultPathTemplate = "{{.Path}}"
+	DefaultCreator      = "Studio One Preset Tool"
+)
+
+// Options are the settings a Config is built from, as given on the command line or in a profile.
+type Options struct {
+	InPath            string
+	OutPath           string
+	RemoveExistingOut bool
+	FXChainMode       string
+	ChannelFXChains   bool
+	OnConflict        string
+	Prune             bool
+	Jobs              int
+	NameTemplate      string
+	PathTemplate      string
+	ASCIINames        bool
+	Creator           string
 }
 
-func New(inPath string, outPath string, removeExistingOut bool) *Config {
-	re := regexp.MustCompile(`(.*)\/(.*\.song)`)
-	pathInMatch := re.FindStringSubmatch(inPath)
+// New validates the options. Empty templates, creator, FX chain mode and conflict policy fall back to their defaults.
+func New(opts Options) (*Config, error) {
+	if opts.InPath == "" {
+		return nil, errors.New("No in path set")
+	}
+
+	inPath, err := filepath.Abs(opts.InPath)
+	if err != nil {
+		return nil, fmt.Errorf("No valid in path set: %s", err)
+	}
 
-	if pathInMatch[1] == "" && pathInMatch[2] == "" {
-		panic("No valid in path set")
+	// The type of song is recognised by its contents, so any extension and extracted songs work
+	kind, err := file.DetectSong(inPath)
+	if err != nil {
+		return nil, fmt.Errorf("No valid in path set: %s", err)
 	}
 
-	if outPath == "" {
-		panic("No valid out path set")
+	fileName := filepath.Base(inPath)
+	name := fileName
+	if kind == file.SongArchive {
+		name = strings.TrimSuffix(fileName, filepath.Ext(fileName))
 	}
 
-	tempPath := path.Join(os.TempDir(), "studio-one-preset-tool")
+	fxChainMode := FXChainMode(opts.FXChainMode)
+	if fxChainMode == "" {
+		fxChainMode = FXChainModeOff
+	}
+	switch fxChainMode {
+	case FXChainModeOff, FXChainModeCombined, FXChainModeMultipreset:
+	default:
+		return nil, fmt.Errorf("No valid fx chain mode set: %q", opts.FXChainMode)
+	}
+
+	onConflict := ConflictPolicy(opts.OnConflict)
+	// Files the manifest doesn't own may be made by hand, they are only overwritten when asked for
+	if onConflict == "" {
+		onConflict = ConflictPolicyRename
+	}
+	switch onConflict {
+	case ConflictPolicySkip, ConflictPolicyOverwrite, ConflictPolicyRename, ConflictPolicyFail:
+	default:
+		return nil, fmt.Errorf("No valid conflict policy set: %q", opts.OnConflict)
+	}
+
+	if opts.Jobs < 1 {
+		return nil, fmt.Errorf("No valid number of jobs set: %d", opts.Jobs)
+	}
+
+	nameTemplate := opts.NameTemplate
+	if nameTemplate == "" {
+		nameTemplate = DefaultNameTemplate
+	}
+	parsedNameTemplate, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("No valid name template set: %s", err)
+	}
+
+	pathTemplate := opts.PathTemplate
+	if pathTemplate == "" {
+		pathTemplate = DefaultPathTemplate
+	}
+	parsedPathTemplate, err := template.New("path").Option("missingkey=error").Parse(pathTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("No valid path template set: %s", err)
+	}
+
+	creator := opts.Creator
+	if creator == "" {
+		creator = DefaultCreator
+	}
 
 	return &Config{
 		In: in{
-			Path:     pathInMatch[1],
-			FileName: pathInMatch[2],
-			Full:     inPath,
+			Path:     filepath.ToSlash(filepath.Dir(inPath)),
+			FileName: fileName,
+			Full:     filepath.ToSlash(inPath),
+			Name:     name,
+			Kind:     kind,
 		},
 		Out: out{
-			Path: outPath,
-		},
-		Temp: temp{
-			Path:                   tempPath,
-			SongContentsPath:       path.Join(tempPath, "song-contents"),
-			PresetConstructionPath: path.Join(tempPath, "preset-construction"),
+			Path: opts.OutPath,
 		},
-		RemoveExistingOut: removeExistingOut,
-	}
+		RemoveExistingOut: opts.RemoveExistingOut,
+		FXChainMode:       fxChainMode,
+		ChannelFXChains:   opts.ChannelFXChains,
+		OnConflict:        onConflict,
+		Prune:             opts.Prune,
+		Jobs:              opts.Jobs,
+		NameTemplate:      parsedNameTemplate,
+		PathTemplate:      parsedPathTemplate,
+		ASCIINames:        opts.ASCIINames,
+		Creator:           creator,
+	}, nil
 }
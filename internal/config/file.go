@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileName is the name of the project-local configuration file, looked up in the working directory.
+const FileName = ".studio-one-preset-tool.yaml"
+
+// File is a configuration file with named profiles. Every profile maps the names of command line flags to values:
+//
+//	default: library
+//	profiles:
+//	  library:
+//	    in-dir: ~/Studio One/Songs
+//	    out-path: ~/Studio One/Presets/Generated
+//	    on-conflict: rename
+//	    path-template: "{{.DeviceBaseName}}/{{.Path}}"
+//	    exclude: ['path:"Drafts/**"']
+//	    creator: Jane Doe
+type File struct {
+	// Default is the profile used when none is selected
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Profile holds settings by flag name. Values are strings, booleans, numbers or lists of those.
+type Profile map[string]any
+
+// DefaultPaths returns the configuration files that are read when none is given: the user-level file first, then the
+// project-local file, whose profiles take precedence.
+func DefaultPaths() []string {
+	var paths []string
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "studio-one-preset-tool", "config.yaml"))
+	}
+
+	return append(paths, FileName)
+}
+
+// LoadFiles reads and merges configuration files, settings of later files override earlier ones. Files that don't
+// exist are skipped unless required is set.
+func LoadFiles(paths []string, required bool) (*File, error) {
+	merged := &File{Profiles: make(map[string]Profile)}
+
+	for _, filePath := range paths {
+		data, err := os.ReadFile(filePath)
+		if errors.Is(err, fs.ErrNotExist) && !required {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading config file: %s", err)
+		}
+
+		var file File
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("Error parsing config file %s: %s", filePath, err)
+		}
+
+		if file.Default != "" {
+			merged.Default = file.Default
+		}
+
+		for name, profile := range file.Profiles {
+			if merged.Profiles[name] == nil {
+				merged.Profiles[name] = make(Profile)
+			}
+			for key, value := range profile {
+				merged.Profiles[name][key] = value
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+// Profile returns the named profile, or the default profile when name is empty. An empty name without a default
+// returns no profile and no error.
+func (f *File) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = f.Default
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	profile, ok := f.Profiles[name]
+	if !ok {
+		var names []string
+		for profileName := range f.Profiles {
+			names = append(names, profileName)
+		}
+		sort.Strings(names)
+
+		if len(names) == 0 {
+			return nil, fmt.Errorf("Unknown profile %q, no profiles are configured", name)
+		}
+		return nil, fmt.Errorf("Unknown profile %q, available profiles are %s", name, strings.Join(names, ", "))
+	}
+
+	return profile, nil
+}
+
+// Values returns the setting as the strings a flag is set from, lists give one value per item.
+func (p Profile) Values(key string) ([]string, error) {
+	switch value := p[key].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{expandHome(value)}, nil
+	case bool, int, int64, float64:
+		return []string{fmt.Sprint(value)}, nil
+	case []any:
+		var values []string
+		for _, item := range value {
+			switch item.(type) {
+			case string, bool, int, int64, float64:
+				values = append(values, expandHome(fmt.Sprint(item)))
+			default:
+				return nil, fmt.Errorf("Setting %q has an invalid list item %v", key, item)
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("Setting %q has an invalid value %v", key, value)
+	}
+}
+
+// expandHome replaces a leading ~ by the home directory, as config files are not expanded by a shell.
+func expandHome(value string) string {
+	if value != "~" && !strings.HasPrefix(value, "~/") {
+		return value
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return value
+	}
+
+	return filepath.ToSlash(filepath.Join(home, strings.TrimPrefix(value, "~")))
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestLoadFiles(t *testing.T) {
+	user := writeConfigFile(t, `
+default: library
+profiles:
+  library:
+    out-path: /presets
+    creator: Jane
+    jobs: 4
+  drafts:
+    include: ['path:"Drafts/**"']
+`)
+	project := writeConfigFile(t, `
+profiles:
+  library:
+    creator: Band
+    ascii-names: true
+`)
+
+	file, err := LoadFiles([]string{user, filepath.Join(t.TempDir(), "missing.yaml"), project}, false)
+	if err != nil {
+		t.Fatalf("LoadFiles returned error: %s", err)
+	}
+
+	profile, err := file.Profile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		// Later files override single settings, the other settings of the profile are kept
+		{"creator", "Band"},
+		{"out-path", "/presets"},
+		{"jobs", "4"},
+		{"ascii-names", "true"},
+		{"prune", ""},
+	}
+	for _, test := range tests {
+		values, err := profile.Values(test.key)
+		if err != nil {
+			t.Fatalf("Values(%q) returned error: %s", test.key, err)
+		}
+		if got := strings.Join(values, ","); got != test.want {
+			t.Errorf("Values(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+
+	drafts, err := file.Profile("drafts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := drafts.Values("include"); len(values) != 1 || values[0] != `path:"Drafts/**"` {
+		t.Errorf("drafts include = %q, want one filter", values)
+	}
+
+	if _, err := file.Profile("unknown"); err == nil || !strings.Contains(err.Error(), "drafts, library") {
+		t.Errorf("Profile(\"unknown\") = %v, want an error listing the profiles", err)
+	}
+}
+
+func TestLoadFilesErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	if _, err := LoadFiles([]string{missing}, true); err == nil {
+		t.Error("LoadFiles of a missing required file succeeded")
+	}
+
+	if _, err := LoadFiles([]string{writeConfigFile(t, "profiles: [")}, false); err == nil {
+		t.Error("LoadFiles of invalid YAML succeeded")
+	}
+
+	file, err := LoadFiles([]string{missing}, false)
+	if err != nil {
+		t.Fatalf("LoadFiles of a missing optional file returned error: %s", err)
+	}
+	if profile, err := file.Profile(""); profile != nil || err != nil {
+		t.Errorf("Profile without a default = %v, %v, want no profile", profile, err)
+	}
+}
+
+func TestProfileValues(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	profile := Profile{
+		"out-path": "~/Presets",
+		"in-path":  "a~/song",
+		"exclude":  []any{"Drafts/**", true, 2},
+		"invalid":  map[string]any{"a": 1},
+		"list":     []any{[]any{"a"}},
+	}
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"out-path", []string{filepath.ToSlash(filepath.Join(home, "Presets"))}},
+		{"in-path", []string{"a~/song"}},
+		{"exclude", []string{"Drafts/**", "true", "2"}},
+	}
+	for _, test := range tests {
+		values, err := profile.Values(test.key)
+		if err != nil {
+			t.Fatalf("Values(%q) returned error: %s", test.key, err)
+		}
+		if strings.Join(values, "|") != strings.Join(test.want, "|") {
+			t.Errorf("Values(%q) = %q, want %q", test.key, values, test.want)
+		}
+	}
+
+	for _, key := range []string{"invalid", "list"} {
+		if _, err := profile.Values(key); err == nil {
+			t.Errorf("Values(%q) succeeded, want an error", key)
+		}
+	}
+}
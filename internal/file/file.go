@@ -1,46 +1,38 @@
 package file
 
 import (
-	"context"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
-	"github.com/saracen/fastzip"
 	"io"
+	"io/fs"
 	"os"
-	"path"
 	"path/filepath"
+	"time"
 )
 
-func WriteXML[T interface{}](content T, filePath string) error {
-	// Create XML file
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
+// MarshalXML encodes the content as an indented XML document including the XML header.
+func MarshalXML[T interface{}](content T) ([]byte, error) {
+	var buf bytes.Buffer
 
-	if _, err = file.WriteString(xml.Header); err != nil {
-		return err
+	if _, err := buf.WriteString(xml.Header); err != nil {
+		return nil, err
 	}
 
-	// Write XML content
-	encoder := xml.NewEncoder(file)
+	encoder := xml.NewEncoder(&buf)
 	encoder.Indent("", "  ")
-	err = encoder.Encode(content)
-	if err != nil {
-		return err
-	}
-
-	// Close file
-	err = file.Close()
-	if err != nil {
-		return err
+	if err := encoder.Encode(content); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return buf.Bytes(), nil
 }
 
-func ReadXML[T interface{}](filePath string) (*T, error) {
-	file, err := os.Open(path.Join(filePath))
+func ReadXML[T interface{}](fsys fs.FS, filePath string) (*T, error) {
+	file, err := fsys.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("Error opening XML file: %w", err)
 	}
@@ -61,76 +53,166 @@ func ReadXML[T interface{}](filePath string) (*T, error) {
 	return unmarshalledXML, nil
 }
 
-func Copy(src string, dst string) error {
-	sourceFile, err := os.Open(src)
+// ZipContentsEqual reports whether an in-memory zip archive and a zip archive on disk contain the same entries with
+// the same data, ignoring timestamps and compression settings.
+func ZipContentsEqual(data []byte, filePath string) (bool, error) {
+	a, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
+	aContents, err := readZipContents(a)
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceFile)
+	b, err := zip.OpenReader(filePath)
 	if err != nil {
-		return err
+		return false, err
 	}
+	defer b.Close()
 
-	err = destFile.Sync()
+	bContents, err := readZipContents(&b.Reader)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	if len(aContents) != len(bContents) {
+		return false, nil
+	}
+
+	for name, data := range aContents {
+		other, ok := bContents[name]
+		if !ok || !bytes.Equal(data, other) {
+			return false, nil
+		}
+	}
+
+	return true, nil
 }
 
-func Compress(ctx context.Context, srcPath string, destPath string, destFileName string) error {
-	if err := os.MkdirAll(destPath, os.ModeDir); err != nil {
-		return err
+func readZipContents(r *zip.Reader) (map[string][]byte, error) {
+	contents := make(map[string][]byte)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		contents[f.Name] = data
+	}
+
+	return contents, nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of the concatenated contents.
+func Hash(contents ...[]byte) string {
+	hash := sha256.New()
+
+	for _, content := range contents {
+		hash.Write(content)
 	}
 
-	// Create archive file
-	w, err := os.Create(path.Join(destPath, destFileName))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ValidateArchive checks that the file is a complete zip archive containing the required entries. Studio One writes
+// songs in several steps, so a song that is being saved fails this check until it is done.
+func ValidateArchive(filePath string, required ...string) error {
+	r, err := zip.OpenReader(filePath)
 	if err != nil {
 		return err
 	}
-	defer w.Close()
+	defer r.Close()
+
+	entries := make(map[string]bool)
+	for _, f := range r.File {
+		entries[f.Name] = true
+	}
+
+	for _, name := range required {
+		if !entries[name] {
+			return fmt.Errorf("%s is missing from %s", name, filePath)
+		}
+	}
+
+	return nil
+}
+
+type ArchiveEntry struct {
+	Name string
+	Data []byte
+}
+
+// CompressEntries builds a zip archive in memory.
+func CompressEntries(entries []ArchiveEntry) ([]byte, error) {
+	var buf bytes.Buffer
 
-	// Create new Archiver
-	a, err := fastzip.NewArchiver(w, srcPath)
+	w := zip.NewWriter(&buf)
+	modified := time.Now()
+
+	for _, entry := range entries {
+		f, err := w.CreateHeader(&zip.FileHeader{
+			Name:     entry.Name,
+			Method:   zip.Deflate,
+			Modified: modified,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := f.Write(entry.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteFileAtomic writes data to a temp file next to filePath and renames it into place, so readers either see the
+// old file or the complete new one.
+func WriteFileAtomic(filePath string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), fmt.Sprintf(".%s.*.tmp", filepath.Base(filePath)))
 	if err != nil {
 		return err
 	}
-	defer a.Close()
 
-	// Walk directory, adding the files we want to add
-	files := make(map[string]os.FileInfo)
-	err = filepath.Walk(srcPath, func(pathname string, info os.FileInfo, err error) error {
-		files[pathname] = info
-		return nil
-	})
+	// Clean up the temp file on any failure, after a successful rename this is a no-op
+	defer os.Remove(tmp.Name())
 
-	// Archive
-	if err = a.Archive(ctx, files); err != nil {
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
 		return err
 	}
 
-	return nil
-}
+	// CreateTemp only grants access to the owner, match what os.Create would have done
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
 
-func Extract(ctx context.Context, src string, dst string) error {
-	if err := os.MkdirAll(dst, os.ModeTemporary); err != nil {
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
 		return err
 	}
 
-	extractor, err := fastzip.NewExtractor(src, dst)
-	if err != nil {
+	if err := tmp.Close(); err != nil {
 		return err
 	}
-	defer extractor.Close()
 
-	return extractor.Extract(ctx)
+	return os.Rename(tmp.Name(), filePath)
 }
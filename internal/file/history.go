@@ -0,0 +1,109 @@
+package file
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HistoryDir is the folder next to a song in which Studio One keeps the earlier saves of the song.
+const HistoryDir = "History"
+
+// autosaveExt is the extension of the copies Studio One saves automatically while working on a song.
+const autosaveExt = ".autosave"
+
+// Revision is an earlier version of a song, as kept by Studio One.
+type Revision struct {
+	Path     string
+	ModTime  time.Time
+	Size     int64
+	Autosave bool
+}
+
+// Revisions lists the earlier versions of a song, newest first: the saves in its History folder and the autosaves
+// next to it. Files are recognised by their name, see isRevisionName, and by their contents, other files in those
+// folders are ignored.
+func Revisions(songPath string) ([]*Revision, error) {
+	dir := filepath.Dir(songPath)
+	base := filepath.Base(songPath)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+
+	var revisions []*Revision
+
+	add := func(filePath string, entry fs.DirEntry) error {
+		if entry.IsDir() || filepath.Clean(filePath) == filepath.Clean(songPath) {
+			return nil
+		}
+		if !isRevisionName(entry.Name(), name) {
+			return nil
+		}
+
+		autosave := strings.EqualFold(filepath.Ext(entry.Name()), autosaveExt)
+		if filepath.Dir(filePath) == dir && !autosave {
+			// Other files next to the song are exports, copies or the song itself, not revisions
+			return nil
+		}
+
+		if kind, err := DetectSong(filePath); err != nil || kind != SongArchive {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		revisions = append(revisions, &Revision{
+			Path:     filepath.ToSlash(filePath),
+			ModTime:  info.ModTime(),
+			Size:     info.Size(),
+			Autosave: autosave,
+		})
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if err := add(filepath.Join(dir, entry.Name()), entry); err != nil {
+			return nil, err
+		}
+	}
+
+	err = filepath.WalkDir(filepath.Join(dir, HistoryDir), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return add(filePath, entry)
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	sort.SliceStable(revisions, func(i, j int) bool {
+		if !revisions[i].ModTime.Equal(revisions[j].ModTime) {
+			return revisions[i].ModTime.After(revisions[j].ModTime)
+		}
+		return revisions[i].Path > revisions[j].Path
+	})
+
+	return revisions, nil
+}
+
+// isRevisionName reports whether a file name belongs to the song with the given name: the song name followed by an
+// extension, as in "Demo.song" or "Demo.autosave", or by a counter or date in parentheses, as in "Demo (2).song".
+// Songs whose name merely starts with the song name, such as "Demo 2" or "Demolition", are not revisions of "Demo".
+func isRevisionName(fileName string, name string) bool {
+	if len(fileName) < len(name) || !strings.EqualFold(fileName[:len(name)], name) {
+		return false
+	}
+
+	rest := fileName[len(name):]
+	return strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, " (")
+}
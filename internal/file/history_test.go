@@ -0,0 +1,29 @@
+package file
+
+import "testing"
+
+func TestIsRevisionName(t *testing.T) {
+	tests := []struct {
+		fileName string
+		want     bool
+	}{
+		{"Demo.song", true},
+		{"demo.song", true},
+		{"Demo.autosave", true},
+		{"Demo.song.autosave", true},
+		{"Demo (2).song", true},
+		{"Demo (Autosaved).song", true},
+		{"Demo 2.song", false},
+		{"Demo 2.autosave", false},
+		{"Demolition.song", false},
+		{"Demo-old.song", false},
+		{"Dem.song", false},
+		{"Demo", false},
+	}
+
+	for _, test := range tests {
+		if got := isRevisionName(test.fileName, "Demo"); got != test.want {
+			t.Errorf("isRevisionName(%q, \"Demo\") = %t, want %t", test.fileName, got, test.want)
+		}
+	}
+}
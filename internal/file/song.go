@@ -0,0 +1,78 @@
+package file
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SongEntry is the entry every song has, archived or extracted.
+const SongEntry = "Song/song.xml"
+
+type SongKind string
+
+const (
+	// SongArchive is a zip archive, such as a .song or .songtemplate file
+	SongArchive SongKind = "archive"
+	// SongDirectory is an extracted song archive
+	SongDirectory SongKind = "directory"
+)
+
+// SongFS gives access to the entries of a song, whether it is archived or extracted.
+type SongFS interface {
+	fs.FS
+	io.Closer
+}
+
+// DetectSong works out what kind of song the path points to from its contents, the extension is not looked at.
+func DetectSong(filePath string) (SongKind, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	if info.IsDir() {
+		if _, err := os.Stat(filepath.Join(filePath, filepath.FromSlash(SongEntry))); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return "", fmt.Errorf("%s is a directory without %s, not an extracted song", filePath, SongEntry)
+			}
+			return "", err
+		}
+		return SongDirectory, nil
+	}
+
+	if err := ValidateArchive(filePath, SongEntry); err != nil {
+		if errors.Is(err, zip.ErrFormat) {
+			return "", fmt.Errorf("%s is not a song archive", filePath)
+		}
+		return "", err
+	}
+
+	return SongArchive, nil
+}
+
+// OpenSong opens a song archive or extracted song directory for reading its entries.
+func OpenSong(filePath string) (SongFS, error) {
+	kind, err := DetectSong(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == SongDirectory {
+		return &songDir{FS: os.DirFS(filePath)}, nil
+	}
+
+	return zip.OpenReader(filePath)
+}
+
+type songDir struct {
+	fs.FS
+}
+
+func (d *songDir) Close() error {
+	return nil
+}
@@ -0,0 +1,223 @@
+package filter
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/glob"
+	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// Expr is a parsed filter expression that selects presets.
+type Expr interface {
+	Match(preset *reader.PresetMapEntry) bool
+	String() string
+}
+
+// Filter keeps the presets that match at least one include expression, or all of them without any, and none of the
+// exclude expressions.
+type Filter struct {
+	Include []Expr
+	Exclude []Expr
+}
+
+// New parses the include and exclude expressions.
+func New(include []string, exclude []string) (*Filter, error) {
+	f := &Filter{}
+
+	for _, source := range include {
+		expr, err := Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing include %q: %s", source, err)
+		}
+		f.Include = append(f.Include, expr)
+	}
+
+	for _, source := range exclude {
+		expr, err := Parse(source)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing exclude %q: %s", source, err)
+		}
+		f.Exclude = append(f.Exclude, expr)
+	}
+
+	return f, nil
+}
+
+// Empty reports whether the filter keeps every preset.
+func (f *Filter) Empty() bool {
+	return f == nil || (len(f.Include) == 0 && len(f.Exclude) == 0)
+}
+
+// Apply removes the presets the filter rejects from the map, each of them is returned as a skip.
+func (f *Filter) Apply(presetMap reader.PresetMap) reader.Skips {
+	if f.Empty() {
+		return nil
+	}
+
+	var skips reader.Skips
+
+	for id, preset := range presetMap {
+		reason := f.reject(preset)
+		if reason == "" {
+			continue
+		}
+
+		delete(presetMap, id)
+		skips = append(skips, &reader.Skip{
+			Reason:     reader.SkipFiltered,
+			Node:       reason,
+			TrackName:  preset.Name,
+			DeviceName: preset.DeviceName,
+		})
+	}
+
+	return skips
+}
+
+// ApplyFXChains removes the standalone FX chains the filter rejects from the map, each of them is returned as a skip.
+// FX chains have a name and a path but no device, their plugin, category, subcategory and class are empty.
+func (f *Filter) ApplyFXChains(fxChainMap reader.FXChainMap) reader.Skips {
+	if f.Empty() {
+		return nil
+	}
+
+	var skips reader.Skips
+
+	for id, fxChain := range fxChainMap {
+		reason := f.reject(&reader.PresetMapEntry{Name: fxChain.Name, Path: fxChain.Path})
+		if reason == "" {
+			continue
+		}
+
+		delete(fxChainMap, id)
+		skips = append(skips, &reader.Skip{
+			Reason:    reader.SkipFiltered,
+			Node:      reason,
+			TrackName: fxChain.Name,
+		})
+	}
+
+	return skips
+}
+
+// reject returns the reason the preset is filtered out, or an empty string when it is kept.
+func (f *Filter) reject(preset *reader.PresetMapEntry) string {
+	if len(f.Include) > 0 {
+		included := false
+		for _, expr := range f.Include {
+			if expr.Match(preset) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return "no --include matches"
+		}
+	}
+
+	for _, expr := range f.Exclude {
+		if expr.Match(preset) {
+			return fmt.Sprintf("--exclude %s", expr)
+		}
+	}
+
+	return ""
+}
+
+type andExpr struct {
+	left  Expr
+	right Expr
+}
+
+func (e *andExpr) Match(preset *reader.PresetMapEntry) bool {
+	return e.left.Match(preset) && e.right.Match(preset)
+}
+
+func (e *andExpr) String() string {
+	return fmt.Sprintf("(%s && %s)", e.left, e.right)
+}
+
+type orExpr struct {
+	left  Expr
+	right Expr
+}
+
+func (e *orExpr) Match(preset *reader.PresetMapEntry) bool {
+	return e.left.Match(preset) || e.right.Match(preset)
+}
+
+func (e *orExpr) String() string {
+	return fmt.Sprintf("(%s || %s)", e.left, e.right)
+}
+
+type notExpr struct {
+	expr Expr
+}
+
+func (e *notExpr) Match(preset *reader.PresetMapEntry) bool {
+	return !e.expr.Match(preset)
+}
+
+func (e *notExpr) String() string {
+	return fmt.Sprintf("!%s", e.expr)
+}
+
+// fields are the preset properties a term can match on.
+var fields = map[string]bool{
+	"path":        true,
+	"name":        true,
+	"plugin":      true,
+	"category":    true,
+	"subcategory": true,
+	"class":       true,
+}
+
+type termExpr struct {
+	field string
+	value string
+	// regex is only set for name terms
+	regex *regexp.Regexp
+}
+
+func newTermExpr(field string, value string) (*termExpr, error) {
+	if !fields[field] {
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+
+	term := &termExpr{field: field, value: value}
+
+	if field == "name" {
+		regex, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name regex: %s", err)
+		}
+		term.regex = regex
+	} else if _, err := path.Match(value, ""); err != nil {
+		return nil, fmt.Errorf("invalid %s glob %q", field, value)
+	}
+
+	return term, nil
+}
+
+func (e *termExpr) Match(preset *reader.PresetMapEntry) bool {
+	switch e.field {
+	case "path":
+		return glob.Match(e.value, preset.Path)
+	case "name":
+		return e.regex.MatchString(preset.Name)
+	case "plugin":
+		return glob.Match(e.value, preset.DeviceBaseName)
+	case "category":
+		return glob.Match(e.value, preset.DeviceCategory)
+	case "subcategory":
+		return glob.Match(e.value, preset.DeviceSubCategory)
+	case "class":
+		return glob.Match(e.value, preset.DeviceClassID)
+	}
+	return false
+}
+
+func (e *termExpr) String() string {
+	return fmt.Sprintf("%s:%q", e.field, e.value)
+}
@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"testing"
+)
+
+func TestFilterApply(t *testing.T) {
+	presetMap := reader.PresetMap{
+		"1": {Name: "Lead", Path: "Synths/Leads", DeviceBaseName: "Serum"},
+		"2": {Name: "Lead Draft", Path: "Synths/Leads", DeviceBaseName: "Serum"},
+		"3": {Name: "Pad", Path: "Synths", DeviceBaseName: "Mai Tai"},
+		"4": {Name: "Kick", Path: "Drums", DeviceBaseName: "Impact XT"},
+	}
+
+	f, err := New(
+		[]string{`path:"Synths/**" && (plugin:Serum || plugin:"Mai*")`},
+		[]string{`name:"(?i)draft"`},
+	)
+	if err != nil {
+		t.Fatalf("New returned error: %s", err)
+	}
+
+	skips := f.Apply(presetMap)
+
+	for _, id := range []string{"1", "3"} {
+		if _, ok := presetMap[id]; !ok {
+			t.Errorf("preset %s was filtered out, want it kept", id)
+		}
+	}
+	for _, id := range []string{"2", "4"} {
+		if _, ok := presetMap[id]; ok {
+			t.Errorf("preset %s was kept, want it filtered out", id)
+		}
+	}
+	if len(skips) != 2 {
+		t.Errorf("Apply returned %d skips, want 2", len(skips))
+	}
+}
+
+func TestFilterApplyFXChains(t *testing.T) {
+	fxChainMap := reader.FXChainMap{
+		"1": {Name: "Vocals", Path: "Vox"},
+		"2": {Name: "Vocals Draft", Path: "Vox"},
+		"3": {Name: "Reverb"},
+		"4": {Name: "Kick", Path: "Drums"},
+	}
+
+	f, err := New([]string{`path:"Vox/**" || name:Reverb`}, []string{`name:"(?i)draft" || plugin:Serum`})
+	if err != nil {
+		t.Fatalf("New returned error: %s", err)
+	}
+
+	skips := f.ApplyFXChains(fxChainMap)
+
+	for _, id := range []string{"1", "3"} {
+		if _, ok := fxChainMap[id]; !ok {
+			t.Errorf("FX chain %s was filtered out, want it kept", id)
+		}
+	}
+	for _, id := range []string{"2", "4"} {
+		if _, ok := fxChainMap[id]; ok {
+			t.Errorf("FX chain %s was kept, want it filtered out", id)
+		}
+	}
+	if len(skips) != 2 {
+		t.Errorf("ApplyFXChains returned %d skips, want 2", len(skips))
+	}
+}
@@ -0,0 +1,208 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenColon
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+	tokenEnd
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// Parse parses a filter expression. Terms have the form field:value, where field is one of path, name, plugin,
+// category, subcategory or class and the value is a bare word or a double quoted string. A value without a field
+// matches the path. Terms combine with &&, || and !, grouped by parentheses:
+//
+//	path:"Synths/**" && (plugin:"Serum" || plugin:"Mai") && !name:"(?i)draft"
+//
+// Names are matched as regular expressions, everything else as globs.
+func Parse(source string) (Expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); next.kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %q at %d", next.value, next.pos)
+	}
+
+	return expr, nil
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == ':':
+			tokens = append(tokens, token{kind: tokenColon, value: ":", pos: i})
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, value: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, value: ")", pos: i})
+			i++
+		case r == '!':
+			tokens = append(tokens, token{kind: tokenNot, value: "!", pos: i})
+			i++
+		case r == '&' || r == '|':
+			if i+1 >= len(runes) || runes[i+1] != r {
+				return nil, fmt.Errorf("expected %c%c at %d", r, r, i)
+			}
+			kind := tokenAnd
+			if r == '|' {
+				kind = tokenOr
+			}
+			tokens = append(tokens, token{kind: kind, value: string([]rune{r, r}), pos: i})
+			i += 2
+		case r == '"':
+			var value strings.Builder
+			start := i
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated string at %d", start)
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					value.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == '"' {
+					i++
+					break
+				}
+				value.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value.String(), pos: start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`:()!&|"`, runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, value: string(runes[start:i]), pos: start})
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd, pos: len(runes)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenNot:
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr: expr}, nil
+	case tokenOpen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenClose {
+			return nil, fmt.Errorf("expected ) at %d", closing.pos)
+		}
+		return expr, nil
+	case tokenWord, tokenString:
+		if t.kind == tokenWord && p.peek().kind == tokenColon {
+			p.next()
+			value := p.next()
+			if value.kind != tokenWord && value.kind != tokenString {
+				return nil, fmt.Errorf("expected a value for %s at %d", t.value, value.pos)
+			}
+			return newTermExpr(strings.ToLower(t.value), value.value)
+		}
+		return newTermExpr("path", t.value)
+	case tokenEnd:
+		return nil, errors.New("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+	}
+}
@@ -0,0 +1,64 @@
+package filter
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`Synths/**`, `path:"Synths/**"`},
+		{`"Synths/Lead *"`, `path:"Synths/Lead *"`},
+		{`Plugin:Serum`, `plugin:"Serum"`},
+		{`name:"Bass \"Sub\""`, `name:"Bass \"Sub\""`},
+		{`a || b && c`, `(path:"a" || (path:"b" && path:"c"))`},
+		{`a && b || c`, `((path:"a" && path:"b") || path:"c")`},
+		{`(a || b) && c`, `((path:"a" || path:"b") && path:"c")`},
+		{`!a && b`, `(!path:"a" && path:"b")`},
+		{`!(a || b)`, `!(path:"a" || path:"b")`},
+		{`!!a`, `!!path:"a"`},
+		{`a&&b||c`, `((path:"a" && path:"b") || path:"c")`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			expr, err := Parse(test.source)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", test.source, err)
+			}
+			if got := expr.String(); got != test.want {
+				t.Errorf("Parse(%q) = %s, want %s", test.source, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []string{
+		``,
+		`a &`,
+		`a & b`,
+		`a | b`,
+		`a &&`,
+		`|| a`,
+		`(a`,
+		`a)`,
+		`()`,
+		`!`,
+		`a b`,
+		`"Synths`,
+		`plugin:`,
+		`plugin:(`,
+		`vendor:Serum`,
+		`name:"("`,
+		`path:"["`,
+	}
+
+	for _, source := range tests {
+		t.Run(source, func(t *testing.T) {
+			if expr, err := Parse(source); err == nil {
+				t.Errorf("Parse(%q) = %s, want an error", source, expr)
+			}
+		})
+	}
+}
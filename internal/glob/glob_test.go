@@ -0,0 +1,62 @@
+package glob
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"Synths", "Synths", true},
+		{"Synths", "Synths/Leads", false},
+		{"Synths/*", "Synths/Leads", true},
+		{"Synths/*", "Synths/Leads/Mono", false},
+		{"Synths/**", "Synths", true},
+		{"Synths/**", "Synths/Leads", true},
+		{"Synths/**", "Synths/Leads/Mono", true},
+		{"Synths/**", "Drums/Synths", false},
+		{"**/Leads", "Leads", true},
+		{"**/Leads", "Synths/Leads", true},
+		{"**/Leads", "Synths/Leads/Mono", false},
+		{"Synths/**/Mono", "Synths/Mono", true},
+		{"Synths/**/Mono", "Synths/Leads/Old/Mono", true},
+		{"Synths/**/**/Mono", "Synths/Leads/Mono", true},
+		{"Synths/**/Mono", "Synths/Leads/Poly", false},
+		{"**", "", true},
+		{"**", "a/b/c", true},
+		{"*.song", "Live.song", true},
+		{"*.song", "2024/Live.song", false},
+		{"**/*.song", "2024/Live.song", true},
+		{"[", "[", false},
+	}
+
+	for _, test := range tests {
+		if got := Match(test.pattern, test.name); got != test.want {
+			t.Errorf("Match(%q, %q) = %t, want %t", test.pattern, test.name, got, test.want)
+		}
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	patterns := []string{"Drums/**", "**/Bass"}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Drums/Kicks", true},
+		{"Synths/Bass", true},
+		{"Synths/Leads", false},
+	}
+
+	for _, test := range tests {
+		if got := MatchAny(patterns, test.name); got != test.want {
+			t.Errorf("MatchAny(%q, %q) = %t, want %t", patterns, test.name, got, test.want)
+		}
+	}
+
+	if MatchAny(nil, "Drums") {
+		t.Error("MatchAny without patterns matched, want no match")
+	}
+}
@@ -0,0 +1,189 @@
+package instrument
+
+import (
+	"archive/zip"
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"bholtland/studio-one-preset-tool-go/internal/writer"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// The metadata entries every preset package has next to its data files.
+const (
+	MetaInfoEntry    = "metainfo.xml"
+	PresetPartsEntry = "presetparts.xml"
+)
+
+// Attributes are the attributes of metainfo.xml or of a preset part, in the order of the file.
+type Attributes []writer.MetaAttribute
+
+// Get returns the value of the attribute, or an empty string when it is not set.
+func (a Attributes) Get(id string) string {
+	for _, attribute := range a {
+		if attribute.ID == id {
+			return attribute.Value
+		}
+	}
+	return ""
+}
+
+// WithPrefix returns the attributes whose ID starts with prefix, by the rest of their ID.
+func (a Attributes) WithPrefix(prefix string) map[string]string {
+	values := make(map[string]string)
+	for _, attribute := range a {
+		if name, ok := strings.CutPrefix(attribute.ID, prefix); ok {
+			values[name] = attribute.Value
+		}
+	}
+	return values
+}
+
+// Package is a .instrument preset package, as written by this tool or saved by Studio One.
+type Package struct {
+	// Attributes holds every attribute of metainfo.xml, the fields below are the ones commonly needed
+	Attributes Attributes
+	ClassID    string
+	ClassName  string
+	Title      string
+	// DeviceSlot holds the DeviceSlot:* attributes by the name after the prefix, such as deviceName
+	DeviceSlot map[string]string
+	// Parts lists the devices of the preset from presetparts.xml, the instrument first followed by its inserts
+	Parts []*Part
+
+	fsys   fs.FS
+	closer io.Closer
+}
+
+// Part is a device of a preset package with the data file holding its state.
+type Part struct {
+	Attributes Attributes
+	ClassID    string
+	ClassName  string
+	DataFile   string
+	// Main is set for the instrument part, marked by AudioSynth:IsMainPreset
+	Main bool
+}
+
+// Open opens and reads the preset package at filePath. The package must be closed to release the file.
+func Open(filePath string) (*Package, error) {
+	archive, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening package: %s", err)
+	}
+
+	p, err := Read(archive)
+	if err != nil {
+		archive.Close()
+		return nil, err
+	}
+	p.closer = archive
+
+	return p, nil
+}
+
+// NewReader reads a preset package from a reader, such as a package kept in memory.
+func NewReader(r io.ReaderAt, size int64) (*Package, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening package: %s", err)
+	}
+
+	return Read(archive)
+}
+
+// Read reads the metadata of a preset package from its entries, such as an opened archive or an unpacked directory.
+// Data files are only read when asked for.
+func Read(fsys fs.FS) (*Package, error) {
+	attributes, err := readMetaInfo(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := readParts(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Package{
+		Attributes: attributes,
+		ClassID:    attributes.Get("Class:ID"),
+		ClassName:  attributes.Get("Class:Name"),
+		Title:      attributes.Get("Document:Title"),
+		DeviceSlot: attributes.WithPrefix("DeviceSlot:"),
+		Parts:      parts,
+		fsys:       fsys,
+	}, nil
+}
+
+func readMetaInfo(fsys fs.FS) (Attributes, error) {
+	metaInfo, err := file.ReadXML[writer.MetaInfo](fsys, MetaInfoEntry)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", MetaInfoEntry, err)
+	}
+
+	return metaInfo.Attributes, nil
+}
+
+func readParts(fsys fs.FS) ([]*Part, error) {
+	presetParts, err := file.ReadXML[writer.PresetParts](fsys, PresetPartsEntry)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", PresetPartsEntry, err)
+	}
+
+	var parts []*Part
+	for _, presetPart := range presetParts.PresetPart {
+		attributes := Attributes(presetPart.Attributes)
+		parts = append(parts, &Part{
+			Attributes: attributes,
+			ClassID:    attributes.Get("Class:ID"),
+			ClassName:  attributes.Get("Class:Name"),
+			DataFile:   attributes.Get("Preset:DataFile"),
+			Main:       attributes.Get("AudioSynth:IsMainPreset") == "1",
+		})
+	}
+
+	return parts, nil
+}
+
+// Close releases the file of a package opened with Open.
+func (p *Package) Close() error {
+	if p.closer == nil {
+		return nil
+	}
+	return p.closer.Close()
+}
+
+// FS gives access to every entry of the package.
+func (p *Package) FS() fs.FS {
+	return p.fsys
+}
+
+// MainPart returns the instrument part of the package, the first part when none is marked, or nil for a package
+// without parts.
+func (p *Package) MainPart() *Part {
+	for _, part := range p.Parts {
+		if part.Main {
+			return part
+		}
+	}
+	if len(p.Parts) > 0 {
+		return p.Parts[0]
+	}
+	return nil
+}
+
+// ReadDataFile returns the contents of the data file of a part, the state of its device.
+func (p *Package) ReadDataFile(part *Part) ([]byte, error) {
+	if part.DataFile == "" {
+		return nil, fmt.Errorf("The %s part has no Preset:DataFile", part.ClassName)
+	}
+
+	data, err := fs.ReadFile(p.fsys, part.DataFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading data file %s: %s", part.DataFile, err)
+	}
+
+	return data, nil
+}
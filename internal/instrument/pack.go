@@ -0,0 +1,218 @@
+package instrument
+
+import (
+	"archive/zip"
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"bholtland/studio-one-preset-tool-go/internal/writer"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidPackage is returned by Pack when the unpacked package fails validation.
+var ErrInvalidPackage = errors.New("the package is not valid")
+
+// sharedAttributes are the metainfo.xml attributes the main part in presetparts.xml repeats, in the order the writer
+// puts them.
+var sharedAttributes = []string{
+	"Class:ID",
+	"Class:Name",
+	"Class:Category",
+	"Class:SubCategory",
+	"DeviceSlot:deviceName",
+	"DeviceSlot:deviceUID",
+	"DeviceSlot:slotUID",
+}
+
+// Unpack extracts every entry of the package at filePath into dir, which is created when it doesn't exist and must
+// be empty otherwise.
+func Unpack(filePath string, dir string) error {
+	p, err := Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", dir)
+	}
+
+	return fs.WalkDir(p.FS(), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		data, err := fs.ReadFile(p.FS(), name)
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %s", name, err)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
+
+// Pack builds the package at filePath from an unpacked package in dir. Only metainfo.xml, presetparts.xml and the
+// data files presetparts.xml lists are packed, other files in dir are left out. The presetparts.xml is regenerated so
+// edits to metainfo.xml carry over to the main part, dir itself is not changed. The package is validated before it is
+// written, when that fails the report is returned with ErrInvalidPackage and nothing is written.
+func Pack(ctx context.Context, dir string, filePath string) (*Report, error) {
+	inside, err := isInside(filePath, dir)
+	if err != nil {
+		return nil, err
+	}
+	if inside {
+		return nil, fmt.Errorf("The package %s can't be written inside the directory %s that is packed", filePath, dir)
+	}
+
+	fsys := os.DirFS(dir)
+
+	metaInfoData, err := fs.ReadFile(fsys, MetaInfoEntry)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", MetaInfoEntry, err)
+	}
+
+	presetPartsData, parts, err := regeneratePresetParts(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Data files that can't be read are left out, validation reports them
+	var entries []file.ArchiveEntry
+	for _, part := range parts {
+		if part.DataFile == "" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, part.DataFile)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, file.ArchiveEntry{Name: part.DataFile, Data: data})
+	}
+	entries = append(entries,
+		file.ArchiveEntry{Name: MetaInfoEntry, Data: metaInfoData},
+		file.ArchiveEntry{Name: PresetPartsEntry, Data: presetPartsData},
+	)
+
+	data, err := file.CompressEntries(entries)
+	if err != nil {
+		return nil, fmt.Errorf("Error compressing package: %s", err)
+	}
+
+	// The archive is validated as it will be written
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Error compressing package: %s", err)
+	}
+	report := ValidateFS(filePath, archive)
+	if !report.Valid {
+		return report, ErrInvalidPackage
+	}
+
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return report, err
+	}
+	if err := file.WriteFileAtomic(filePath, data); err != nil {
+		return report, fmt.Errorf("Error writing package: %s", err)
+	}
+
+	return report, nil
+}
+
+// isInside reports whether filePath is dir or below it.
+func isInside(filePath string, dir string) (bool, error) {
+	absFile, err := filepath.Abs(filePath)
+	if err != nil {
+		return false, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+
+	rel, err := filepath.Rel(absDir, absFile)
+	if err != nil {
+		// On another volume
+		return false, nil
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// regeneratePresetParts builds the presetparts.xml of an unpacked package with the shared attributes of the main
+// part taken from metainfo.xml. FX chains have no class in their metainfo.xml, their parts are kept as they are.
+func regeneratePresetParts(fsys fs.FS) ([]byte, []*Part, error) {
+	attributes, err := readMetaInfo(fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parts, err := readParts(fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	presetParts := &writer.PresetParts{}
+	main := (&Package{Parts: parts}).MainPart()
+
+	for _, part := range parts {
+		partAttributes := part.Attributes
+		if part == main && attributes.Get("Class:ID") != "" {
+			partAttributes = mergeAttributes(attributes, part.Attributes)
+		}
+		presetParts.PresetPart = append(presetParts.PresetPart, writer.PresetPart{Attributes: partAttributes})
+	}
+
+	data, err := file.MarshalXML(presetParts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, parts, nil
+}
+
+// mergeAttributes returns the attributes of a main part with the shared attributes set from metainfo.xml, followed
+// by the attributes of the part only.
+func mergeAttributes(metaInfo Attributes, part Attributes) Attributes {
+	shared := make(map[string]bool)
+	var merged Attributes
+
+	for _, id := range sharedAttributes {
+		shared[id] = true
+
+		value := metaInfo.Get(id)
+		if value == "" {
+			value = part.Get(id)
+		}
+		if value != "" {
+			merged = append(merged, writer.MetaAttribute{ID: id, Value: value})
+		}
+	}
+
+	for _, attribute := range part {
+		if !shared[attribute.ID] {
+			merged = append(merged, attribute)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,141 @@
+package instrument
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeUnpacked writes an unpacked package to a new directory, the class ID of metainfo.xml differs from the one
+// presetparts.xml repeats, as after editing metainfo.xml by hand.
+func writeUnpacked(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func unpackedFiles() map[string]string {
+	return map[string]string{
+		MetaInfoEntry:    strings.Replace(testMetaInfo, "{CLASS}", "{EDITED}", 1),
+		PresetPartsEntry: testPresetParts,
+		"Lead.preset":    "state",
+		"notes.txt":      "not part of the package",
+	}
+}
+
+func TestPack(t *testing.T) {
+	dir := writeUnpacked(t, unpackedFiles())
+	filePath := filepath.Join(t.TempDir(), "Packed", "Lead.instrument")
+
+	report, err := Pack(context.Background(), dir, filePath)
+	if err != nil {
+		t.Fatalf("Pack returned error: %s", err)
+	}
+	if !report.Valid {
+		t.Errorf("Pack returned an invalid report: %+v", report.Failed())
+	}
+
+	p, err := Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var names []string
+	err = fs.WalkDir(p.FS(), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			names = append(names, name)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if got, want := strings.Join(names, ", "), "Lead.preset, metainfo.xml, presetparts.xml"; got != want {
+		t.Errorf("Package holds %s, want %s", got, want)
+	}
+
+	if main := p.MainPart(); main.ClassID != "{EDITED}" {
+		t.Errorf("Main part has Class:ID %s, want the one from metainfo.xml", main.ClassID)
+	}
+
+	// The directory is left as it was
+	presetParts, err := os.ReadFile(filepath.Join(dir, PresetPartsEntry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(presetParts) != testPresetParts {
+		t.Error("Pack changed the presetparts.xml of the directory")
+	}
+}
+
+func TestPackInvalid(t *testing.T) {
+	files := unpackedFiles()
+	delete(files, "Lead.preset")
+	dir := writeUnpacked(t, files)
+	filePath := filepath.Join(t.TempDir(), "Lead.instrument")
+
+	report, err := Pack(context.Background(), dir, filePath)
+	if !errors.Is(err, ErrInvalidPackage) {
+		t.Fatalf("Pack returned %v, want ErrInvalidPackage", err)
+	}
+	if report == nil || report.Valid {
+		t.Error("Pack returned no failing report")
+	}
+	if _, err := os.Stat(filePath); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Pack wrote an invalid package")
+	}
+}
+
+func TestPackInsideDir(t *testing.T) {
+	dir := writeUnpacked(t, unpackedFiles())
+
+	for _, filePath := range []string{
+		filepath.Join(dir, "Lead.instrument"),
+		filepath.Join(dir, "sub", "Lead.instrument"),
+		dir,
+	} {
+		if _, err := Pack(context.Background(), dir, filePath); err == nil {
+			t.Errorf("Pack to %s succeeded, want an error for a path inside the directory", filePath)
+		}
+	}
+
+	// A sibling whose name starts with the directory name is not inside it
+	if _, err := Pack(context.Background(), dir, dir+"-packed.instrument"); err != nil {
+		t.Errorf("Pack next to the directory returned error: %s", err)
+	}
+}
+
+func TestUnpackPack(t *testing.T) {
+	dir := writeUnpacked(t, unpackedFiles())
+	filePath := filepath.Join(t.TempDir(), "Lead.instrument")
+	if _, err := Pack(context.Background(), dir, filePath); err != nil {
+		t.Fatal(err)
+	}
+
+	unpacked := filepath.Join(t.TempDir(), "Lead")
+	if err := Unpack(filePath, unpacked); err != nil {
+		t.Fatalf("Unpack returned error: %s", err)
+	}
+	data, err := os.ReadFile(filepath.Join(unpacked, "Lead.preset"))
+	if err != nil || string(data) != "state" {
+		t.Errorf("Unpacked Lead.preset = %q, %v, want \"state\"", data, err)
+	}
+
+	// Unpacking into a directory that is not empty is refused
+	if err := Unpack(filePath, dir); err == nil {
+		t.Error("Unpack into a directory that is not empty succeeded")
+	}
+}
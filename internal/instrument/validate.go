@@ -0,0 +1,156 @@
+package instrument
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// The checks Validate runs, in order.
+const (
+	CheckArchive      = "archive"
+	CheckMetaInfo     = "metainfo"
+	CheckPresetParts  = "presetparts"
+	CheckDataFiles    = "data-files"
+	CheckClassIDs     = "class-ids"
+	CheckDataNotEmpty = "data-not-empty"
+)
+
+// Check is the outcome of one check of a package.
+type Check struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// Report holds the checks run on a package. Checks that need the outcome of a failed check are not run.
+type Report struct {
+	Path   string   `json:"path"`
+	Valid  bool     `json:"valid"`
+	Checks []*Check `json:"checks"`
+}
+
+func (r *Report) add(name string, problems []string) bool {
+	r.Checks = append(r.Checks, &Check{Name: name, Passed: len(problems) == 0, Message: strings.Join(problems, "; ")})
+	return len(problems) == 0
+}
+
+// Failed returns the checks that didn't pass.
+func (r *Report) Failed() []*Check {
+	var failed []*Check
+	for _, check := range r.Checks {
+		if !check.Passed {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// Validate checks that Studio One can load the preset package at filePath: the archive opens, metainfo.xml and
+// presetparts.xml parse, every data file they reference is in the archive and not empty, and the class IDs agree.
+func Validate(filePath string) *Report {
+	report := &Report{Path: filePath}
+
+	archive, err := zip.OpenReader(filePath)
+	if !report.add(CheckArchive, errorProblems(err)) {
+		return report
+	}
+	defer archive.Close()
+
+	validate(report, archive)
+
+	return report
+}
+
+// ValidateFS runs the checks of Validate after the archive has been opened, on the entries of a package. The
+// extension of name tells an .instrument from an FX chain.
+func ValidateFS(name string, fsys fs.FS) *Report {
+	report := &Report{Path: name}
+	validate(report, fsys)
+	return report
+}
+
+func validate(report *Report, fsys fs.FS) {
+	defer func() {
+		report.Valid = len(report.Failed()) == 0
+	}()
+
+	attributes, err := readMetaInfo(fsys)
+	metaInfoOK := report.add(CheckMetaInfo, errorProblems(err))
+
+	parts, err := readParts(fsys)
+	problems := errorProblems(err)
+	if err == nil && len(parts) == 0 {
+		problems = append(problems, fmt.Sprintf("%s has no PresetPart", PresetPartsEntry))
+	}
+	if !report.add(CheckPresetParts, problems) {
+		return
+	}
+
+	var missing []string
+	var existing []*Part
+	for i, part := range parts {
+		if part.DataFile == "" {
+			missing = append(missing, fmt.Sprintf("part #%d has no Preset:DataFile", i+1))
+			continue
+		}
+		if _, err := fs.Stat(fsys, part.DataFile); err != nil {
+			missing = append(missing, fmt.Sprintf("%s is not in the archive", part.DataFile))
+			continue
+		}
+		existing = append(existing, part)
+	}
+	report.add(CheckDataFiles, missing)
+
+	if metaInfoOK {
+		instrument := strings.EqualFold(path.Ext(report.Path), ".instrument")
+		report.add(CheckClassIDs, classIDProblems(attributes, parts, instrument))
+	}
+
+	var empty []string
+	for _, part := range existing {
+		info, err := fs.Stat(fsys, part.DataFile)
+		if err != nil {
+			empty = append(empty, err.Error())
+		} else if info.Size() == 0 {
+			empty = append(empty, fmt.Sprintf("%s is empty", part.DataFile))
+		}
+	}
+	report.add(CheckDataNotEmpty, empty)
+}
+
+// classIDProblems compares the class of the package with its main part. FX chains don't name a class in their
+// metainfo.xml, only their parts are checked then. An instrument must name one.
+func classIDProblems(attributes Attributes, parts []*Part, instrument bool) []string {
+	var problems []string
+
+	for i, part := range parts {
+		if part.ClassID == "" {
+			problems = append(problems, fmt.Sprintf("part #%d has no Class:ID", i+1))
+		}
+	}
+
+	classID := attributes.Get("Class:ID")
+	if classID == "" {
+		if instrument {
+			problems = append(problems, fmt.Sprintf("%s has no Class:ID", MetaInfoEntry))
+		}
+		return problems
+	}
+
+	main := (&Package{Parts: parts}).MainPart()
+	if main.ClassID != "" && main.ClassID != classID {
+		problems = append(problems, fmt.Sprintf("%s has Class:ID %s but the main part in %s has %s", MetaInfoEntry, classID, PresetPartsEntry, main.ClassID))
+	}
+
+	return problems
+}
+
+func errorProblems(err error) []string {
+	if err == nil {
+		return nil
+	}
+	return []string{err.Error()}
+}
@@ -0,0 +1,107 @@
+package instrument
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+)
+
+const testMetaInfo = `<?xml version="1.0" encoding="UTF-8"?>
+<MetaInformation>
+	<Attribute id="Class:ID" value="{CLASS}"/>
+	<Attribute id="Document:Title" value="Lead"/>
+</MetaInformation>`
+
+const testFXChainMetaInfo = `<?xml version="1.0" encoding="UTF-8"?>
+<MetaInformation>
+	<Attribute id="Document:Title" value="Verb"/>
+</MetaInformation>`
+
+const testPresetParts = `<?xml version="1.0" encoding="UTF-8"?>
+<PresetParts>
+	<PresetPart>
+		<Attribute id="Class:ID" value="{CLASS}"/>
+		<Attribute id="AudioSynth:IsMainPreset" value="1"/>
+		<Attribute id="Preset:DataFile" value="Lead.preset"/>
+	</PresetPart>
+</PresetParts>`
+
+func TestValidateFS(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		failed []string
+	}{
+		{
+			name: "Lead.instrument",
+			files: map[string]string{
+				MetaInfoEntry:    testMetaInfo,
+				PresetPartsEntry: testPresetParts,
+				"Lead.preset":    "state",
+			},
+		},
+		{
+			name: "Lead.instrument",
+			files: map[string]string{
+				MetaInfoEntry:    testFXChainMetaInfo,
+				PresetPartsEntry: testPresetParts,
+				"Lead.preset":    "state",
+			},
+			failed: []string{CheckClassIDs},
+		},
+		{
+			name: "Verb.multipreset",
+			files: map[string]string{
+				MetaInfoEntry:    testFXChainMetaInfo,
+				PresetPartsEntry: testPresetParts,
+				"Lead.preset":    "state",
+			},
+		},
+		{
+			name: "Lead.instrument",
+			files: map[string]string{
+				MetaInfoEntry:    testMetaInfo,
+				PresetPartsEntry: testPresetParts,
+				"Lead.preset":    "",
+			},
+			failed: []string{CheckDataNotEmpty},
+		},
+		{
+			name: "Lead.instrument",
+			files: map[string]string{
+				MetaInfoEntry:    testMetaInfo,
+				PresetPartsEntry: testPresetParts,
+			},
+			failed: []string{CheckDataFiles},
+		},
+		{
+			name: "Lead.instrument",
+			files: map[string]string{
+				MetaInfoEntry:    testMetaInfo,
+				PresetPartsEntry: "<PresetParts>",
+				"Lead.preset":    "state",
+			},
+			failed: []string{CheckPresetParts},
+		},
+	}
+
+	for _, test := range tests {
+		fsys := fstest.MapFS{}
+		for name, content := range test.files {
+			fsys[name] = &fstest.MapFile{Data: []byte(content)}
+		}
+
+		report := ValidateFS(test.name, fsys)
+
+		var failed []string
+		for _, check := range report.Failed() {
+			failed = append(failed, check.Name)
+		}
+		if fmt.Sprint(failed) != fmt.Sprint(test.failed) {
+			t.Errorf("%s with %d files: failed checks = %v, want %v", test.name, len(test.files), failed, test.failed)
+		}
+		if report.Valid != (len(test.failed) == 0) {
+			t.Errorf("%s with %d files: Valid = %t, want %t", test.name, len(test.files), report.Valid, len(test.failed) == 0)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package reader
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"regexp"
+)
+
+type insertXML struct {
+	XID  string `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+	UID  []struct {
+		XID string `xml:"id,attr"`
+		UID string `xml:"uid,attr"`
+	} `xml:"UID"`
+	Attributes []struct {
+		XID  string `xml:"id,attr"`
+		Name string `xml:"name,attr"`
+		UID  []struct {
+			XID string `xml:"id,attr"`
+			UID string `xml:"uid,attr"`
+		} `xml:"UID"`
+		Attributes []struct {
+			XID         string `xml:"id,attr"`
+			Name        string `xml:"name,attr"`
+			Category    string `xml:"category,attr"`
+			SubCategory string `xml:"subCategory,attr"`
+		} `xml:"Attributes"`
+	} `xml:"Attributes"`
+	String []struct {
+		XID  string `xml:"id,attr"`
+		Text string `xml:"text,attr"`
+	} `xml:"String"`
+}
+
+type AudioMixerXML struct {
+	XMLName    xml.Name `xml:"AudioMixer"`
+	Attributes []struct {
+		XID          string `xml:"id,attr"`
+		ChannelGroup []struct {
+			Name     string `xml:"name,attr"`
+			Channels []struct {
+				XMLName xml.Name
+				Label   string `xml:"label,attr"`
+				UID     []struct {
+					XID string `xml:"id,attr"`
+					UID string `xml:"uid,attr"`
+				} `xml:"UID"`
+				Attributes []struct {
+					XID     string      `xml:"id,attr"`
+					Inserts []insertXML `xml:"Attributes"`
+				} `xml:"Attributes"`
+			} `xml:",any"`
+		} `xml:"ChannelGroup"`
+	} `xml:"Attributes"`
+}
+
+type AudioMixerMap map[string]*AudioMixerMapEntry
+
+type AudioMixerMapEntry struct {
+	ChannelID   string
+	ChannelType string
+	Label       string
+	Inserts     []*InsertMapEntry
+}
+
+type InsertMapEntry struct {
+	DeviceClassID     string
+	DeviceName        string
+	DeviceUID         string
+	DeviceCategory    string
+	DeviceSubCategory string
+	DeviceBaseName    string
+	PresetPath        string
+	PresetFileName    string
+}
+
+type AudioMixerReader struct {
+	fsys fs.FS
+}
+
+func NewAudioMixerReader(fsys fs.FS) *AudioMixerReader {
+	return &AudioMixerReader{
+		fsys: fsys,
+	}
+}
+
+const audioMixerPath = "Devices/audiomixer.xml"
+
+func (s *AudioMixerReader) GetMap() (AudioMixerMap, Skips, error) {
+	xml, err := file.ReadXML[AudioMixerXML](s.fsys, audioMixerPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	audioMixerMap, skips := s.buildAudioMixerMap(xml)
+	return audioMixerMap, skips, nil
+}
+
+func (s *AudioMixerReader) buildAudioMixerMap(audioMixer *AudioMixerXML) (AudioMixerMap, Skips) {
+	audioMixerMap := make(AudioMixerMap)
+	var skips Skips
+
+	for _, attributes := range audioMixer.Attributes {
+		for _, group := range attributes.ChannelGroup {
+			for i, channel := range group.Channels {
+				node := fmt.Sprintf("%s %s #%d", audioMixerPath, channel.XMLName.Local, i+1)
+
+				var channelID string
+				for _, tag := range channel.UID {
+					if tag.XID == "uniqueID" {
+						channelID = tag.UID
+					}
+				}
+				if channelID == "" {
+					skips = append(skips, &Skip{Reason: SkipMissingMixerChannelID, Node: node, TrackName: channel.Label})
+					continue
+				}
+
+				var inserts []*InsertMapEntry
+				for _, tag := range channel.Attributes {
+					if tag.XID != "Inserts" {
+						continue
+					}
+
+					for j, insert := range tag.Inserts {
+						entry, reason := s.buildInsertMapEntry(&insert)
+						if entry == nil {
+							skips = append(skips, &Skip{
+								Reason:     reason,
+								Node:       fmt.Sprintf("%s Inserts #%d", node, j+1),
+								TrackName:  channel.Label,
+								DeviceName: insert.Name,
+							})
+							continue
+						}
+						inserts = append(inserts, entry)
+					}
+				}
+
+				audioMixerMap[channelID] = &AudioMixerMapEntry{
+					ChannelID:   channelID,
+					ChannelType: channel.XMLName.Local,
+					Label:       channel.Label,
+					Inserts:     inserts,
+				}
+			}
+		}
+	}
+
+	return audioMixerMap, skips
+}
+
+func (s *AudioMixerReader) buildInsertMapEntry(insert *insertXML) (*InsertMapEntry, SkipReason) {
+	var deviceClassID string
+	for _, tag := range insert.UID {
+		if tag.XID == "deviceClassID" {
+			deviceClassID = tag.UID
+		}
+	}
+	if deviceClassID == "" {
+		return nil, SkipMissingInsertDeviceClassID
+	}
+
+	var deviceName string
+	var deviceUID string
+	var deviceCategory string
+	var deviceSubCategory string
+	var deviceBaseName string
+	for _, tag := range insert.Attributes {
+		if tag.XID == "deviceData" {
+			deviceName = tag.Name
+
+			for _, uidTag := range tag.UID {
+				if uidTag.XID == "uniqueID" {
+					deviceUID = uidTag.UID
+				}
+			}
+		}
+		if tag.XID == "ghostData" {
+			for _, attrTag := range tag.Attributes {
+				if attrTag.XID == "classInfo" {
+					deviceCategory = attrTag.Category
+					deviceSubCategory = attrTag.SubCategory
+					deviceBaseName = attrTag.Name
+				}
+			}
+		}
+	}
+	if deviceName == "" || deviceUID == "" {
+		return nil, SkipMissingInsertDeviceData
+	}
+	if deviceBaseName == "" {
+		return nil, SkipMissingInsertDeviceBaseName
+	}
+
+	var presetPath string
+	for _, tag := range insert.String {
+		if tag.XID == "presetPath" {
+			presetPath = tag.Text
+		}
+	}
+	if presetPath == "" {
+		return nil, SkipMissingInsertPresetPath
+	}
+
+	pattern := `.*/([^/]+)$`
+	regex := regexp.MustCompile(pattern)
+	matches := regex.FindStringSubmatch(presetPath)
+
+	var presetFileName string
+	if len(matches) > 1 {
+		presetFileName = matches[1]
+	} else {
+		return nil, SkipInvalidInsertPresetPath
+	}
+
+	return &InsertMapEntry{
+		DeviceClassID:     deviceClassID,
+		DeviceName:        deviceName,
+		DeviceUID:         deviceUID,
+		DeviceCategory:    deviceCategory,
+		DeviceSubCategory: deviceSubCategory,
+		DeviceBaseName:    deviceBaseName,
+		PresetPath:        presetPath,
+		PresetFileName:    presetFileName,
+	}, ""
+}
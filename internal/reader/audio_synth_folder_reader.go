@@ -1,11 +1,10 @@
 package reader
 
 import (
-	"bholtland/studio-one-preset-tool-go/internal/config"
 	"bholtland/studio-one-preset-tool-go/internal/file"
 	"encoding/xml"
-	"log/slog"
-	"path"
+	"fmt"
+	"io/fs"
 	"regexp"
 )
 
@@ -58,38 +57,38 @@ type AudioSynthFolderMapEntry struct {
 }
 
 type AudioSynthFolderReader struct {
-	cfg *config.Config
+	fsys fs.FS
 }
 
-func NewAudioSynthFolderReader(cfg *config.Config) *AudioSynthFolderReader {
+func NewAudioSynthFolderReader(fsys fs.FS) *AudioSynthFolderReader {
 	return &AudioSynthFolderReader{
-		cfg: cfg,
+		fsys: fsys,
 	}
 }
 
-func (s *AudioSynthFolderReader) GetMap() (AudioSynthFolderMap, error) {
-	xml, err := file.ReadXML[AudioSynthFolderXML](path.Join(s.cfg.Temp.SongContentsPath, "Devices", "audiosynthfolder.xml"))
+const audioSynthFolderPath = "Devices/audiosynthfolder.xml"
+
+func (s *AudioSynthFolderReader) GetMap() (AudioSynthFolderMap, Skips, error) {
+	xml, err := file.ReadXML[AudioSynthFolderXML](s.fsys, audioSynthFolderPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return s.buildAudioSynthFolderMap(xml), nil
+	audioSynthFolderMap, skips := s.buildAudioSynthFolderMap(xml)
+	return audioSynthFolderMap, skips, nil
 }
 
-func (s *AudioSynthFolderReader) buildAudioSynthFolderMap(audioSynthFolder *AudioSynthFolderXML) AudioSynthFolderMap {
+func (s *AudioSynthFolderReader) buildAudioSynthFolderMap(audioSynthFolder *AudioSynthFolderXML) (AudioSynthFolderMap, Skips) {
 	audioSynthFolderMap := make(AudioSynthFolderMap)
+	var skips Skips
 
-	for _, entry := range audioSynthFolder.Attributes {
+	for i, entry := range audioSynthFolder.Attributes {
 		var musicTrackDeviceID string
 		for _, tag := range entry.List {
 			if tag.XID == "synthChannels" {
 				musicTrackDeviceID = tag.UID.UID
 			}
 		}
-		if musicTrackDeviceID == "" {
-			slog.Error("Music Track Device ID is empty")
-			continue
-		}
 
 		var deviceClassID string
 		for _, tag := range entry.UID {
@@ -97,10 +96,6 @@ func (s *AudioSynthFolderReader) buildAudioSynthFolderMap(audioSynthFolder *Audi
 				deviceClassID = tag.UID
 			}
 		}
-		if deviceClassID == "" {
-			slog.Error("Device Class ID is empty")
-			continue
-		}
 
 		var deviceName string
 		var deviceUID string
@@ -127,35 +122,53 @@ func (s *AudioSynthFolderReader) buildAudioSynthFolderMap(audioSynthFolder *Audi
 				}
 			}
 		}
+
+		var presetPath string
+		for _, tag := range entry.String {
+			if tag.XID == "presetPath" {
+				presetPath = tag.Text
+			}
+		}
+
+		skip := func(reason SkipReason) {
+			skips = append(skips, &Skip{
+				Reason:             reason,
+				Node:               fmt.Sprintf("%s Attributes #%d", audioSynthFolderPath, i+1),
+				DeviceName:         deviceName,
+				musicTrackDeviceID: musicTrackDeviceID,
+			})
+		}
+
+		if musicTrackDeviceID == "" {
+			skip(SkipMissingSynthChannel)
+			continue
+		}
+		if deviceClassID == "" {
+			skip(SkipMissingDeviceClassID)
+			continue
+		}
 		if deviceName == "" {
-			slog.Error("Device Name is empty")
+			skip(SkipMissingDeviceName)
 			continue
 		}
 		if deviceUID == "" {
-			slog.Error("Device UID is empty")
+			skip(SkipMissingDeviceUID)
 			continue
 		}
 		if deviceCategory == "" {
-			slog.Error("Device Category is empty")
+			skip(SkipMissingDeviceCategory)
 			continue
 		}
 		if deviceSubCategory == "" {
-			slog.Error("Device Sub Category is empty")
+			skip(SkipMissingDeviceSubCategory)
 			continue
 		}
 		if deviceBaseName == "" {
-			slog.Error("Device Base Name is empty")
+			skip(SkipMissingDeviceBaseName)
 			continue
 		}
-
-		var presetPath string
-		for _, tag := range entry.String {
-			if tag.XID == "presetPath" {
-				presetPath = tag.Text
-			}
-		}
 		if presetPath == "" {
-			slog.Error("Preset Path is empty")
+			skip(SkipMissingPresetPath)
 			continue
 		}
 
@@ -167,7 +180,7 @@ func (s *AudioSynthFolderReader) buildAudioSynthFolderMap(audioSynthFolder *Audi
 		if len(matches) > 1 {
 			presetFileName = matches[1]
 		} else {
-			slog.Error("No regex matches found for preset path")
+			skip(SkipInvalidPresetPath)
 			continue
 		}
 
@@ -184,5 +197,5 @@ func (s *AudioSynthFolderReader) buildAudioSynthFolderMap(audioSynthFolder *Audi
 		}
 	}
 
-	return audioSynthFolderMap
+	return audioSynthFolderMap, skips
 }
@@ -0,0 +1,57 @@
+package reader
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"bholtland/studio-one-preset-tool-go/internal/song"
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"log/slog"
+)
+
+type MetaInfoXML struct {
+	XMLName    xml.Name `xml:"MetaInformation"`
+	Attributes []struct {
+		ID    string `xml:"id,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"Attribute"`
+}
+
+type MetaInfoReader struct {
+	fsys fs.FS
+}
+
+func NewMetaInfoReader(fsys fs.FS) *MetaInfoReader {
+	return &MetaInfoReader{
+		fsys: fsys,
+	}
+}
+
+const metaInfoPath = "metainfo.xml"
+
+// GetVersion returns the version of Studio One the song was saved with, or nil when the song has no metainfo.xml or
+// the generator it names can't be parsed.
+func (s *MetaInfoReader) GetVersion() (*song.Version, error) {
+	xml, err := file.ReadXML[MetaInfoXML](s.fsys, metaInfoPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attribute := range xml.Attributes {
+		if attribute.ID != "Document:Generator" {
+			continue
+		}
+
+		version, err := song.ParseVersion(attribute.Value)
+		if err != nil {
+			slog.Warn("Unknown song version, reading it as a current Studio One song", "error", err)
+			return nil, nil
+		}
+		return version, nil
+	}
+
+	return nil, nil
+}
@@ -1,11 +1,10 @@
 package reader
 
 import (
-	"bholtland/studio-one-preset-tool-go/internal/config"
 	"bholtland/studio-one-preset-tool-go/internal/file"
 	"encoding/xml"
-	"log/slog"
-	"path"
+	"fmt"
+	"io/fs"
 	"regexp"
 )
 
@@ -35,29 +34,49 @@ type MusicTrackDeviceMapEntry struct {
 }
 
 type MusicTrackDeviceReader struct {
-	cfg *config.Config
+	fsys fs.FS
 }
 
-func NewMusicTrackDeviceReader(cfg *config.Config) *MusicTrackDeviceReader {
+func NewMusicTrackDeviceReader(fsys fs.FS) *MusicTrackDeviceReader {
 	return &MusicTrackDeviceReader{
-		cfg: cfg,
+		fsys: fsys,
 	}
 }
 
-func (s *MusicTrackDeviceReader) GetMap() (MusicTrackDeviceMap, error) {
-	xml, err := file.ReadXML[MusicTrackDeviceXML](path.Join(s.cfg.Temp.SongContentsPath, "Devices", "musictrackdevice.xml"))
+const musicTrackDevicePath = "Devices/musictrackdevice.xml"
+
+func (s *MusicTrackDeviceReader) GetMap() (MusicTrackDeviceMap, Skips, error) {
+	xml, err := file.ReadXML[MusicTrackDeviceXML](s.fsys, musicTrackDevicePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return s.BuildMusicTrackDeviceMap(xml), nil
+	musicTrackDeviceMap, skips := s.BuildMusicTrackDeviceMap(xml)
+	return musicTrackDeviceMap, skips, nil
 }
 
-func (s *MusicTrackDeviceReader) BuildMusicTrackDeviceMap(musicTrackDevice *MusicTrackDeviceXML) MusicTrackDeviceMap {
+func (s *MusicTrackDeviceReader) BuildMusicTrackDeviceMap(musicTrackDevice *MusicTrackDeviceXML) (MusicTrackDeviceMap, Skips) {
 	musicTrackDeviceMap := make(MusicTrackDeviceMap)
+	var skips Skips
 
-	for _, entry := range musicTrackDevice.Attributes.ChannelGroup.MusicTrackChannel {
-		if entry.Connection == nil {
+	for i, entry := range musicTrackDevice.Attributes.ChannelGroup.MusicTrackChannel {
+		var songID string
+		for _, UIDEntry := range entry.UID {
+			if UIDEntry.XID == "uniqueID" {
+				songID = UIDEntry.UID
+			}
+		}
+
+		skip := func(reason SkipReason) {
+			skips = append(skips, &Skip{
+				Reason: reason,
+				Node:   fmt.Sprintf("%s MusicTrackChannel #%d", musicTrackDevicePath, i+1),
+				songID: songID,
+			})
+		}
+
+		if songID == "" {
+			skip(SkipMissingMusicChannelID)
 			continue
 		}
 
@@ -72,7 +91,7 @@ func (s *MusicTrackDeviceReader) BuildMusicTrackDeviceMap(musicTrackDevice *Musi
 			}
 		}
 		if objectID == "" {
-			slog.Error("Object ID is empty")
+			skip(SkipMissingInstrumentOut)
 			continue
 		}
 
@@ -85,18 +104,7 @@ func (s *MusicTrackDeviceReader) BuildMusicTrackDeviceMap(musicTrackDevice *Musi
 		if len(matches) > 1 {
 			musicTrackDeviceId = matches[1]
 		} else {
-			slog.Error("No regex matches found for object ID")
-			continue
-		}
-
-		var songID string
-		for _, UIDEntry := range entry.UID {
-			if UIDEntry.XID == "uniqueID" {
-				songID = UIDEntry.UID
-			}
-		}
-		if songID == "" {
-			slog.Error("Song ID is empty")
+			skip(SkipInvalidInstrumentOut)
 			continue
 		}
 
@@ -106,5 +114,5 @@ func (s *MusicTrackDeviceReader) BuildMusicTrackDeviceMap(musicTrackDevice *Musi
 		}
 	}
 
-	return musicTrackDeviceMap
+	return musicTrackDeviceMap, skips
 }
@@ -2,7 +2,9 @@ package reader
 
 import (
 	"bholtland/studio-one-preset-tool-go/internal/config"
-	"log/slog"
+	"fmt"
+	"io/fs"
+	"strings"
 )
 
 type PresetMap map[string]*PresetMapEntry
@@ -19,91 +21,178 @@ type PresetMapEntry struct {
 	Name              string
 	Path              string
 	SongID            string
+	Inserts           []*InsertMapEntry
+}
+
+type FXChainMap map[string]*FXChainMapEntry
+
+type FXChainMapEntry struct {
+	ChannelID   string
+	ChannelType string
+	Name        string
+	Path        string
+	Inserts     []*InsertMapEntry
+}
+
+// fxChainChannelTypes are the mixer channels exported as standalone FX chains. Instrument channels are handled
+// together with their instrument preset.
+var fxChainChannelTypes = map[string]bool{
+	"AudioTrackChannel":  true,
+	"AudioGroupChannel":  true,
+	"AudioEffectChannel": true,
 }
 
 type Service struct {
 	audioSynthFolderReader *AudioSynthFolderReader
+	audioMixerReader       *AudioMixerReader
+	metaInfoReader         *MetaInfoReader
 	musicTrackDeviceReader *MusicTrackDeviceReader
 	songReader             *SongReader
 	cfg                    *config.Config
 }
 
-func NewService(cfg *config.Config) *Service {
+// NewService creates a reader for the contents of a song, typically the opened song archive.
+func NewService(cfg *config.Config, song fs.FS) *Service {
 	return &Service{
-		audioSynthFolderReader: NewAudioSynthFolderReader(cfg),
-		musicTrackDeviceReader: NewMusicTrackDeviceReader(cfg),
-		songReader:             NewSongReader(cfg),
+		audioSynthFolderReader: NewAudioSynthFolderReader(song),
+		audioMixerReader:       NewAudioMixerReader(song),
+		metaInfoReader:         NewMetaInfoReader(song),
+		musicTrackDeviceReader: NewMusicTrackDeviceReader(song),
+		songReader:             NewSongReader(song),
 		cfg:                    cfg,
 	}
 }
 
-func (s *Service) GetPresets() (PresetMap, error) {
-	songMap, folderMap, err := s.songReader.GetMap()
-	if err != nil {
-		return nil, err
-	}
-
-	audioSynthFolderMap, err := s.audioSynthFolderReader.GetMap()
-	if err != nil {
-		return nil, err
-	}
+// GetPresets joins the instruments of the song to their tracks. Everything that could not be turned into a preset is
+// returned as a skip explaining why.
+func (s *Service) GetPresets() (PresetMap, Skips, error) {
+	withInserts := s.cfg.FXChainMode != config.FXChainModeOff
 
-	musicTrackDeviceMap, err := s.musicTrackDeviceReader.GetMap()
+	song, skips, err := s.readSong(withInserts)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var presetMap = make(PresetMap)
 
-	for _, audioSynthFolderEntry := range audioSynthFolderMap {
-		musicTrackDeviceEntry, ok := musicTrackDeviceMap[audioSynthFolderEntry.MusicTrackDeviceID]
-		if !ok {
-			slog.Error("Music Track Device not found for track")
+	for _, instrument := range song.Instruments {
+		if len(instrument.Connections) == 0 {
+			skips = append(skips, &Skip{
+				Reason:     SkipNoMusicTrackChannel,
+				Node:       fmt.Sprintf("%s synthChannels %s", audioSynthFolderPath, instrument.ID),
+				DeviceName: instrument.Name,
+			})
 			continue
 		}
 
-		songEntry, ok := songMap[musicTrackDeviceEntry.SongID]
-		if !ok {
-			slog.Error("Music Track Device not found for track")
+		if len(instrument.Tracks) == 0 {
+			skips = append(skips, &Skip{
+				Reason:     SkipNoTrack,
+				Node:       fmt.Sprintf("%s MusicTrackChannel %s", musicTrackDevicePath, instrument.Connections[0].TrackChannelID),
+				DeviceName: instrument.Name,
+			})
 			continue
 		}
 
-		path := GetPath(songEntry.ParentTrackID, folderMap)
+		track := instrument.Tracks[0]
 
 		preset := &PresetMapEntry{
-			DeviceClassID:     audioSynthFolderEntry.DeviceClassID,
-			DeviceBaseName:    audioSynthFolderEntry.DeviceBaseName,
-			DeviceCategory:    audioSynthFolderEntry.DeviceCategory,
-			DeviceSubCategory: audioSynthFolderEntry.DeviceSubCategory,
-			DeviceName:        audioSynthFolderEntry.DeviceName,
-			DeviceUID:         audioSynthFolderEntry.DeviceUID,
-			TrackID:           songEntry.TrackID,
-			FileName:          audioSynthFolderEntry.PresetFileName,
-			Name:              songEntry.Name,
-			Path:              path,
-			SongID:            musicTrackDeviceEntry.SongID,
+			DeviceClassID:     instrument.ClassID,
+			DeviceBaseName:    instrument.BaseName,
+			DeviceCategory:    instrument.Category,
+			DeviceSubCategory: instrument.SubCategory,
+			DeviceName:        instrument.Name,
+			DeviceUID:         instrument.UID,
+			TrackID:           track.ID,
+			FileName:          instrument.PresetFileName,
+			Name:              track.Name,
+			Path:              track.Path(),
+			SongID:            track.ChannelID,
+		}
+
+		if withInserts && instrument.Channel != nil {
+			preset.Inserts = insertMapEntries(instrument.Channel.Inserts)
+		}
+
+		presetMap[instrument.ID] = preset
+	}
+
+	// Instrument tracks whose instrument was skipped already have a reason, the others have no instrument at all
+	explained := make(map[string]bool)
+	for _, skip := range skips {
+		if skip.musicTrackDeviceID != "" {
+			explained[skip.musicTrackDeviceID] = true
+		}
+	}
+	for _, connection := range song.Connections {
+		if connection.Instrument != nil || explained[connection.InstrumentID] {
+			continue
 		}
-		presetMap[audioSynthFolderEntry.MusicTrackDeviceID] = preset
+
+		skips = append(skips, &Skip{
+			Reason: SkipNoInstrument,
+			Node:   fmt.Sprintf("%s MusicTrackChannel %s", musicTrackDevicePath, connection.TrackChannelID),
+			songID: connection.TrackChannelID,
+		})
 	}
 
-	return presetMap, nil
+	skips.resolve(song)
 
+	return presetMap, skips, nil
 }
 
-func GetPath(parentTrackID string, folderMap FolderMap) string {
-	if parentTrackID == "" {
-		return ""
+// GetFXChains collects the insert chains of audio tracks, buses and FX channels. The skips only cover the mixer, the
+// song itself is reported by GetPresets.
+func (s *Service) GetFXChains() (FXChainMap, Skips, error) {
+	song, skips, err := s.readSong(true)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	folder, ok := folderMap[parentTrackID]
-	if !ok {
-		slog.Error("Folder not found for track")
-		return ""
+	// The skips of the song itself are reported by GetPresets
+	var mixerSkips Skips
+	for _, skip := range skips {
+		if strings.HasPrefix(skip.Node, audioMixerPath) {
+			mixerSkips = append(mixerSkips, skip)
+		}
 	}
 
-	if folder.ParentTrackID == "" {
-		return folder.Name
+	var fxChainMap = make(FXChainMap)
+
+	for _, channel := range song.Channels {
+		if !fxChainChannelTypes[channel.Type] {
+			continue
+		}
+
+		if len(channel.Inserts) == 0 {
+			continue
+		}
+
+		name := channel.Label
+		path := ""
+
+		// Audio tracks live in the song's folder hierarchy, buses and FX channels only exist in the mixer
+		if channel.Track != nil {
+			name = channel.Track.Name
+			path = channel.Track.Path()
+		}
+
+		if name == "" {
+			mixerSkips = append(mixerSkips, &Skip{
+				Reason: SkipMissingChannelName,
+				Node:   fmt.Sprintf("%s %s %s", audioMixerPath, channel.Type, channel.ID),
+			})
+			continue
+		}
+
+		fxChainMap[channel.ID] = &FXChainMapEntry{
+			ChannelID:   channel.ID,
+			ChannelType: channel.Type,
+			Name:        name,
+			Path:        path,
+			Inserts:     insertMapEntries(channel.Inserts),
+		}
 	}
 
-	return GetPath(folder.ParentTrackID, folderMap) + "/" + folder.Name
+	return fxChainMap, mixerSkips, nil
 }
@@ -0,0 +1,131 @@
+package reader
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/song"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+type SkipReason string
+
+const (
+	SkipMissingChannelID            SkipReason = "missing-channel-id"
+	SkipMissingTrackName            SkipReason = "missing-track-name"
+	SkipMissingTrackID              SkipReason = "missing-track-id"
+	SkipMissingMusicChannelID       SkipReason = "missing-music-track-channel-id"
+	SkipMissingInstrumentOut        SkipReason = "missing-instrument-out"
+	SkipInvalidInstrumentOut        SkipReason = "invalid-instrument-out"
+	SkipMissingSynthChannel         SkipReason = "missing-synth-channel"
+	SkipMissingDeviceClassID        SkipReason = "missing-device-class-id"
+	SkipMissingDeviceName           SkipReason = "missing-device-name"
+	SkipMissingDeviceUID            SkipReason = "missing-device-uid"
+	SkipMissingDeviceCategory       SkipReason = "missing-device-category"
+	SkipMissingDeviceSubCategory    SkipReason = "missing-device-sub-category"
+	SkipMissingDeviceBaseName       SkipReason = "missing-device-base-name"
+	SkipMissingPresetPath           SkipReason = "missing-preset-path"
+	SkipInvalidPresetPath           SkipReason = "invalid-preset-path"
+	SkipNoMusicTrackChannel         SkipReason = "no-music-track-channel"
+	SkipNoTrack                     SkipReason = "no-track"
+	SkipNoInstrument                SkipReason = "no-instrument"
+	SkipMissingChannelName          SkipReason = "missing-channel-name"
+	SkipMissingMixerChannelID       SkipReason = "missing-mixer-channel-id"
+	SkipMissingInsertDeviceData     SkipReason = "missing-insert-device-data"
+	SkipMissingInsertPresetPath     SkipReason = "missing-insert-preset-path"
+	SkipInvalidInsertPresetPath     SkipReason = "invalid-insert-preset-path"
+	SkipMissingInsertDeviceClassID  SkipReason = "missing-insert-device-class-id"
+	SkipMissingInsertDeviceBaseName SkipReason = "missing-insert-device-base-name"
+	SkipFiltered                    SkipReason = "filtered"
+)
+
+var skipDescriptions = map[SkipReason]string{
+	SkipMissingChannelID:            "the track has no channelID",
+	SkipMissingTrackName:            "the folder track has no name",
+	SkipMissingTrackID:              "the folder track has no trackID",
+	SkipMissingMusicChannelID:       "the music track channel has no uniqueID",
+	SkipMissingInstrumentOut:        "the music track channel has no instrumentOut connection",
+	SkipInvalidInstrumentOut:        "the instrumentOut connection does not point to an instrument input",
+	SkipMissingSynthChannel:         "the instrument has no synthChannels entry",
+	SkipMissingDeviceClassID:        "the instrument has no deviceClassID",
+	SkipMissingDeviceName:           "the instrument has no deviceData name",
+	SkipMissingDeviceUID:            "the instrument has no deviceData uniqueID",
+	SkipMissingDeviceCategory:       "the instrument classInfo has no category",
+	SkipMissingDeviceSubCategory:    "the instrument classInfo has no subCategory",
+	SkipMissingDeviceBaseName:       "the instrument classInfo has no name",
+	SkipMissingPresetPath:           "the instrument has no presetPath",
+	SkipInvalidPresetPath:           "the instrument presetPath has no file name",
+	SkipNoMusicTrackChannel:         "no music track channel is routed to the instrument",
+	SkipNoTrack:                     "no track in the song uses the music track channel",
+	SkipNoInstrument:                "the track is not routed to an instrument in the song",
+	SkipMissingChannelName:          "the mixer channel has no name",
+	SkipMissingMixerChannelID:       "the mixer channel has no uniqueID",
+	SkipMissingInsertDeviceData:     "the insert has no deviceData name or uniqueID",
+	SkipMissingInsertPresetPath:     "the insert has no presetPath",
+	SkipInvalidInsertPresetPath:     "the insert presetPath has no file name",
+	SkipMissingInsertDeviceClassID:  "the insert has no deviceClassID",
+	SkipMissingInsertDeviceBaseName: "the insert classInfo has no name",
+	SkipFiltered:                    "the preset was filtered out",
+}
+
+// Skip explains why something in the song did not make it into the presets.
+type Skip struct {
+	Reason SkipReason
+	// Node names the XML file and element the problem was found in
+	Node       string
+	TrackName  string
+	DeviceName string
+	// musicTrackDeviceID and songID link a skip to its track once every XML file has been read
+	musicTrackDeviceID string
+	songID             string
+}
+
+type Skips []*Skip
+
+func (s *Skip) Description() string {
+	if description, ok := skipDescriptions[s.Reason]; ok {
+		return description
+	}
+	return string(s.Reason)
+}
+
+func (s *Skip) String() string {
+	var context []string
+	if s.TrackName != "" {
+		context = append(context, fmt.Sprintf("track %q", s.TrackName))
+	}
+	if s.DeviceName != "" {
+		context = append(context, fmt.Sprintf("device %q", s.DeviceName))
+	}
+	context = append(context, s.Node)
+
+	return fmt.Sprintf("%s (%s)", s.Description(), strings.Join(context, ", "))
+}
+
+// Log writes every skip as a structured warning.
+func (s Skips) Log(logger *slog.Logger) {
+	for _, skip := range s {
+		logger.Warn("Skipped", "reason", skip.Reason, "track", skip.TrackName, "device", skip.DeviceName, "node", skip.Node)
+	}
+}
+
+// resolve fills in the track names of skips that were found before the track was known.
+func (s Skips) resolve(song *song.Song) {
+	for _, skip := range s {
+		if skip.TrackName != "" {
+			continue
+		}
+
+		songID := skip.songID
+		if songID == "" && skip.musicTrackDeviceID != "" {
+			for _, connection := range song.Connections {
+				if connection.InstrumentID == skip.musicTrackDeviceID {
+					songID = connection.TrackChannelID
+				}
+			}
+		}
+
+		if track, ok := song.TrackByChannelID(songID); ok {
+			skip.TrackName = track.Name
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package reader
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/song"
+	"errors"
+	"io/fs"
+	"sort"
+)
+
+// GetSong reads the song into its domain model. Songs without an audio mixer are read without mixer channels.
+func (s *Service) GetSong() (*song.Song, Skips, error) {
+	song, skips, err := s.readSong(true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	skips.resolve(song)
+
+	return song, skips, nil
+}
+
+// readSong reads every part of the song and links them into the model. The mixer is only read when withMixer is set,
+// its skips are only returned in that case. Songs saved by a version of Studio One that is too old are refused.
+func (s *Service) readSong(withMixer bool) (*song.Song, Skips, error) {
+	version, err := s.metaInfoReader.GetVersion()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkVersion(version); err != nil {
+		return nil, nil, err
+	}
+
+	songMap, folderMap, skips, err := s.songReader.GetMap()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	audioSynthFolderMap, audioSynthFolderSkips, err := s.audioSynthFolderReader.GetMap()
+	if err != nil {
+		return nil, nil, err
+	}
+	skips = append(skips, audioSynthFolderSkips...)
+
+	musicTrackDeviceMap, musicTrackDeviceSkips, err := s.musicTrackDeviceReader.GetMap()
+	if err != nil {
+		return nil, nil, err
+	}
+	skips = append(skips, musicTrackDeviceSkips...)
+
+	var audioMixerMap AudioMixerMap
+	if withMixer {
+		var audioMixerSkips Skips
+		audioMixerMap, audioMixerSkips, err = s.audioMixerReader.GetMap()
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, err
+		}
+		skips = append(skips, audioMixerSkips...)
+	}
+
+	var folders []*song.Folder
+	for _, id := range sortedKeys(folderMap) {
+		folders = append(folders, &song.Folder{
+			ID:       id,
+			Name:     folderMap[id].Name,
+			ParentID: folderMap[id].ParentTrackID,
+		})
+	}
+
+	var tracks []*song.Track
+	for _, channelID := range sortedKeys(songMap) {
+		tracks = append(tracks, &song.Track{
+			ID:        songMap[channelID].TrackID,
+			ChannelID: channelID,
+			Name:      songMap[channelID].Name,
+			FolderID:  songMap[channelID].ParentTrackID,
+		})
+	}
+
+	var channels []*song.Channel
+	for _, id := range sortedKeys(audioMixerMap) {
+		entry := audioMixerMap[id]
+
+		var inserts []*song.Device
+		for _, insert := range entry.Inserts {
+			inserts = append(inserts, &song.Device{
+				ClassID:        insert.DeviceClassID,
+				Name:           insert.DeviceName,
+				UID:            insert.DeviceUID,
+				Category:       insert.DeviceCategory,
+				SubCategory:    insert.DeviceSubCategory,
+				BaseName:       insert.DeviceBaseName,
+				PresetPath:     insert.PresetPath,
+				PresetFileName: insert.PresetFileName,
+			})
+		}
+
+		channels = append(channels, &song.Channel{
+			ID:      id,
+			Type:    entry.ChannelType,
+			Label:   entry.Label,
+			Inserts: inserts,
+		})
+	}
+
+	var instruments []*song.Instrument
+	for _, id := range sortedKeys(audioSynthFolderMap) {
+		entry := audioSynthFolderMap[id]
+		instruments = append(instruments, &song.Instrument{
+			ID: id,
+			Device: song.Device{
+				ClassID:        entry.DeviceClassID,
+				Name:           entry.DeviceName,
+				UID:            entry.DeviceUID,
+				Category:       entry.DeviceCategory,
+				SubCategory:    entry.DeviceSubCategory,
+				BaseName:       entry.DeviceBaseName,
+				PresetPath:     entry.PresetPath,
+				PresetFileName: entry.PresetFileName,
+			},
+		})
+	}
+
+	var connections []*song.Connection
+	for _, id := range sortedKeys(musicTrackDeviceMap) {
+		connections = append(connections, &song.Connection{
+			TrackChannelID: musicTrackDeviceMap[id].SongID,
+			InstrumentID:   id,
+		})
+	}
+
+	model := song.New(folders, tracks, channels, instruments, connections)
+	model.Version = version
+
+	return model, skips, nil
+}
+
+// insertMapEntries converts the insert devices of a channel back to the entries the writer works with.
+func insertMapEntries(devices []*song.Device) []*InsertMapEntry {
+	var inserts []*InsertMapEntry
+	for _, device := range devices {
+		inserts = append(inserts, &InsertMapEntry{
+			DeviceClassID:     device.ClassID,
+			DeviceName:        device.Name,
+			DeviceUID:         device.UID,
+			DeviceCategory:    device.Category,
+			DeviceSubCategory: device.SubCategory,
+			DeviceBaseName:    device.BaseName,
+			PresetPath:        device.PresetPath,
+			PresetFileName:    device.PresetFileName,
+		})
+	}
+	return inserts
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
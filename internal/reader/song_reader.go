@@ -1,11 +1,10 @@
 package reader
 
 import (
-	"bholtland/studio-one-preset-tool-go/internal/config"
 	"bholtland/studio-one-preset-tool-go/internal/file"
 	"encoding/xml"
-	"log/slog"
-	"path"
+	"fmt"
+	"io/fs"
 )
 
 type SongXML struct {
@@ -47,28 +46,34 @@ type FolderMapEntry struct {
 }
 
 type SongReader struct {
-	cfg *config.Config
+	fsys fs.FS
 }
 
-func NewSongReader(cfg *config.Config) *SongReader {
+func NewSongReader(fsys fs.FS) *SongReader {
 	return &SongReader{
-		cfg: cfg,
+		fsys: fsys,
 	}
 }
 
-func (s *SongReader) GetMap() (SongMap, FolderMap, error) {
-	xml, err := file.ReadXML[SongXML](path.Join(s.cfg.Temp.SongContentsPath, "Song", "song.xml"))
+const songPath = "Song/song.xml"
+
+func (s *SongReader) GetMap() (SongMap, FolderMap, Skips, error) {
+	xml, err := file.ReadXML[SongXML](s.fsys, songPath)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	return s.buildSongMap(xml), s.buildFolderMap(xml), nil
+	songMap, songSkips := s.buildSongMap(xml)
+	folderMap, folderSkips := s.buildFolderMap(xml)
+
+	return songMap, folderMap, append(songSkips, folderSkips...), nil
 }
 
-func (s *SongReader) buildSongMap(song *SongXML) SongMap {
+func (s *SongReader) buildSongMap(song *SongXML) (SongMap, Skips) {
 	songMap := make(map[string]*SongMapEntry)
+	var skips Skips
 
-	for _, entry := range song.Attributes.List.MediaTracks {
+	for i, entry := range song.Attributes.List.MediaTracks {
 		var songID string
 		for _, uidEntry := range entry.UID {
 			if uidEntry.XID == "channelID" {
@@ -77,7 +82,11 @@ func (s *SongReader) buildSongMap(song *SongXML) SongMap {
 		}
 
 		if songID == "" {
-			slog.Error("uid is empty")
+			skips = append(skips, &Skip{
+				Reason:    SkipMissingChannelID,
+				Node:      fmt.Sprintf("%s MediaTrack #%d", songPath, i+1),
+				TrackName: entry.Name,
+			})
 			continue
 		}
 
@@ -90,19 +99,22 @@ func (s *SongReader) buildSongMap(song *SongXML) SongMap {
 		}
 	}
 
-	return songMap
+	return songMap, skips
 }
 
-func (s *SongReader) buildFolderMap(song *SongXML) map[string]*FolderMapEntry {
+func (s *SongReader) buildFolderMap(song *SongXML) (map[string]*FolderMapEntry, Skips) {
 	var presetsMap = make(map[string]*FolderMapEntry)
+	var skips Skips
+
+	for i, track := range song.Attributes.List.FolderTracks {
+		node := fmt.Sprintf("%s FolderTrack #%d", songPath, i+1)
 
-	for _, track := range song.Attributes.List.FolderTracks {
 		if track.Name == "" {
-			slog.Error("Track name is empty")
+			skips = append(skips, &Skip{Reason: SkipMissingTrackName, Node: node})
 			continue
 		}
 		if track.TrackID == "" {
-			slog.Error("Track ID is empty")
+			skips = append(skips, &Skip{Reason: SkipMissingTrackID, Node: node, TrackName: track.Name})
 			continue
 		}
 		presetsMap[track.TrackID] = &FolderMapEntry{
@@ -110,5 +122,5 @@ func (s *SongReader) buildFolderMap(song *SongXML) map[string]*FolderMapEntry {
 			ParentTrackID: track.ParentTrackID,
 		}
 	}
-	return presetsMap
+	return presetsMap, skips
 }
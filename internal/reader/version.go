@@ -0,0 +1,43 @@
+package reader
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/song"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ErrUnsupportedVersion is returned for songs that were not saved by a version of Studio One the readers know.
+var ErrUnsupportedVersion = errors.New("unsupported Studio One version")
+
+// The Studio One versions whose songs have been verified to have the layout the XML types describe. Songs of older
+// versions are refused rather than read into zero presets, as their layout is not known.
+const (
+	oldestMajor = 5
+	newestMajor = 7
+)
+
+// checkVersion refuses songs saved by another application or by a Studio One version older than oldestMajor. Songs
+// of newer versions are read with a warning, as are songs that don't record their version.
+func checkVersion(version *song.Version) error {
+	if version == nil {
+		return nil
+	}
+
+	// Editions add their name, as in "Studio One Pro/7.0.1.104562"
+	application := strings.ToLower(version.Application)
+	if application != "studio one" && !strings.HasPrefix(application, "studio one ") {
+		return fmt.Errorf("%w: the song was saved by %s", ErrUnsupportedVersion, version.Generator)
+	}
+
+	if version.Major < oldestMajor {
+		return fmt.Errorf("%w: the song was saved by Studio One %d (%s), supported versions are %d and newer", ErrUnsupportedVersion, version.Major, version.Generator, oldestMajor)
+	}
+
+	if version.Major > newestMajor {
+		slog.Warn("Song saved by a newer Studio One version than known, reading it like the newest known version", "version", version.Generator, "newest", newestMajor)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package reader
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/song"
+	"errors"
+	"testing"
+)
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		generator string
+		supported bool
+	}{
+		{"Studio One/5.5.2.1", true},
+		{"Studio One/6.5.2.97440", true},
+		{"Studio One/7", true},
+		{"Studio One Pro/7.0.1.104562", true},
+		{"studio one artist/6.1", true},
+		// Newer versions are read with a warning
+		{"Studio One/9.1", true},
+		{"Studio One/4.6.2.58729", false},
+		{"Studio One/3.5", false},
+		{"Studio Onesie/6", false},
+		{"Cubase/13.0.10", false},
+	}
+
+	for _, test := range tests {
+		version, err := song.ParseVersion(test.generator)
+		if err != nil {
+			t.Fatalf("ParseVersion(%q) returned error: %s", test.generator, err)
+		}
+
+		err = checkVersion(version)
+		if test.supported && err != nil {
+			t.Errorf("checkVersion(%q) returned error: %s", test.generator, err)
+		}
+		if !test.supported && !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("checkVersion(%q) = %v, want ErrUnsupportedVersion", test.generator, err)
+		}
+	}
+
+	if err := checkVersion(nil); err != nil {
+		t.Errorf("checkVersion(nil) returned error: %s", err)
+	}
+}
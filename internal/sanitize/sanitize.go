@@ -0,0 +1,136 @@
+package sanitize
+
+import (
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxNameBytes leaves room for an extension and a " (2)" counter within the 255 byte limit of most file systems.
+const maxNameBytes = 200
+
+// replacement stands in for characters that are not allowed in file names.
+const replacement = "_"
+
+// invalidChars are reserved on Windows, "/" is the separator everywhere.
+const invalidChars = `<>:"/\|?*`
+
+// reservedNames can't be used as file names on Windows, regardless of extension or case.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Name makes a single path segment safe to use as a file or folder name on Windows, macOS and Linux. With ascii set,
+// accented letters are transliterated and other non-ASCII characters replaced.
+func Name(name string, ascii bool) string {
+	// Keep the long standing spelling of inch sizes such as 12" Bass
+	name = strings.ReplaceAll(name, "\"", " inch")
+
+	if ascii {
+		name = Transliterate(name)
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r), strings.ContainsRune(invalidChars, r):
+			b.WriteString(replacement)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	name = b.String()
+
+	name = truncate(name, maxNameBytes)
+
+	// Windows drops trailing dots and spaces, which would make two names collide or point elsewhere
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+
+	if name == "" {
+		return replacement
+	}
+
+	base := name
+	if i := strings.Index(base, "."); i >= 0 {
+		base = base[:i]
+	}
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = replacement + name
+	}
+
+	return name
+}
+
+// Path sanitizes every segment of a slash separated path.
+func Path(p string, ascii bool) string {
+	if p == "" {
+		return ""
+	}
+
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = Name(segment, ascii)
+	}
+	return path.Join(segments...)
+}
+
+// Transliterate replaces accented letters and typographic punctuation by their closest ASCII spelling. Characters
+// without one are replaced.
+func Transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		if ascii, ok := transliterations[r]; ok {
+			b.WriteString(ascii)
+			continue
+		}
+		b.WriteString(replacement)
+	}
+	return b.String()
+}
+
+// truncate shortens s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+var transliterations = map[rune]string{
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Ā': "A", 'Ă': "A", 'Ą': "A",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'ß': "ss", 'Þ': "Th", 'þ': "th", 'Ð': "D", 'ð': "d",
+	'Ç': "C", 'Ć': "C", 'Č': "C", 'ç': "c", 'ć': "c", 'č': "c",
+	'Ď': "D", 'Đ': "D", 'ď': "d", 'đ': "d",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ē': "E", 'Ė': "E", 'Ę': "E", 'Ě': "E",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'Ğ': "G", 'ğ': "g",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'Ī': "I", 'İ': "I",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i",
+	'Ł': "L", 'Ľ': "L", 'ł': "l", 'ľ': "l",
+	'Ñ': "N", 'Ń': "N", 'Ň': "N", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O", 'Ō': "O", 'Ő': "O",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'Ř': "R", 'ř': "r",
+	'Ś': "S", 'Š': "S", 'Ş': "S", 'ś': "s", 'š': "s", 'ş': "s",
+	'Ť': "T", 'ť': "t",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ū': "U", 'Ů': "U", 'Ű': "U",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'Ý': "Y", 'Ÿ': "Y", 'ý': "y", 'ÿ': "y",
+	'Ź': "Z", 'Ż': "Z", 'Ž': "Z", 'ź': "z", 'ż': "z", 'ž': "z",
+	'‘': "'", '’': "'", '‚': "'", '“': "'", '”': "'", '„': "'", '″': " inch", '′': "'",
+	'–': "-", '—': "-", '‐': "-", '…': "...", '•': "-", '·': "-",
+	'×': "x", '÷': "-", '°': "deg", '©': "(c)", '®': "(R)", '™': "TM",
+	'½': "1-2", '¼': "1-4", '¾': "3-4", '♯': "#", '♭': "b",
+	' ': " ",
+}
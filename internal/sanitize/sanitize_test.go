@@ -0,0 +1,84 @@
+package sanitize
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		name  string
+		ascii bool
+		want  string
+	}{
+		{"Lead", false, "Lead"},
+		{`12" Bass`, false, "12 inch Bass"},
+		{"Kick/Snare", false, "Kick_Snare"},
+		{`a<b>c:d\e|f?g*h`, false, "a_b_c_d_e_f_g_h"},
+		{"Tab\tName", false, "Tab_Name"},
+		{"Pad...", false, "Pad"},
+		{"Pad. . ", false, "Pad"},
+		{"  Pad", false, "Pad"},
+		{"", false, "_"},
+		{"...", false, "_"},
+		{"CON", false, "_CON"},
+		{"con", false, "_con"},
+		{"Aux.txt", false, "_Aux.txt"},
+		{"COM1", false, "_COM1"},
+		{"LPT9", false, "_LPT9"},
+		{"COM0", false, "COM0"},
+		{"CONSOLE", false, "CONSOLE"},
+		{"Füße", false, "Füße"},
+		{"Füße", true, "Fusse"},
+		{"Piano 🎹", true, "Piano _"},
+	}
+
+	for _, test := range tests {
+		if got := Name(test.name, test.ascii); got != test.want {
+			t.Errorf("Name(%q, %t) = %q, want %q", test.name, test.ascii, got, test.want)
+		}
+	}
+}
+
+func TestNameTruncate(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantLen int
+	}{
+		{strings.Repeat("a", maxNameBytes), maxNameBytes},
+		{strings.Repeat("a", maxNameBytes+1), maxNameBytes},
+		// Two byte characters, the last one would be split at the limit
+		{"a" + strings.Repeat("ü", maxNameBytes), maxNameBytes - 1},
+		// Trailing spaces left at the cut are trimmed
+		{strings.Repeat("a", maxNameBytes-1) + "  b", maxNameBytes - 1},
+	}
+
+	for _, test := range tests {
+		got := Name(test.name, false)
+		if len(got) != test.wantLen {
+			t.Errorf("Name of %d bytes is %d bytes, want %d", len(test.name), len(got), test.wantLen)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("Name of %d bytes is not valid UTF-8", len(test.name))
+		}
+	}
+}
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{"Synths/Leads", "Synths/Leads"},
+		{"Synths/CON/Lead?", "Synths/_CON/Lead_"},
+		{"Synths./Leads ", "Synths/Leads"},
+	}
+
+	for _, test := range tests {
+		if got := Path(test.path, false); got != test.want {
+			t.Errorf("Path(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package song
+
+import (
+	"sort"
+	"strings"
+)
+
+// Song is the navigable model of a Studio One song: the folder tree, the tracks in it, the mixer channels and the
+// instruments the tracks are routed to. Everything is linked both by ID and by pointer, New takes care of the
+// pointers.
+type Song struct {
+	Folders     []*Folder
+	Tracks      []*Track
+	Channels    []*Channel
+	Instruments []*Instrument
+	Connections []*Connection
+	// Version is the application version the song was saved with, nil when the song doesn't record it
+	Version *Version
+
+	foldersByID       map[string]*Folder
+	tracksByID        map[string]*Track
+	tracksByChannelID map[string]*Track
+	channelsByID      map[string]*Channel
+	instrumentsByID   map[string]*Instrument
+}
+
+type Folder struct {
+	ID       string
+	Name     string
+	ParentID string
+
+	Parent  *Folder
+	Folders []*Folder
+	Tracks  []*Track
+}
+
+type Track struct {
+	ID string
+	// ChannelID identifies the channel of the track, the mixer channel for audio tracks and the music track channel
+	// for instrument tracks
+	ChannelID string
+	Name      string
+	FolderID  string
+
+	Folder *Folder
+	// Channel is the mixer channel of an audio track
+	Channel *Channel
+	// Instrument is the instrument an instrument track plays
+	Instrument *Instrument
+}
+
+// Channel is a channel of the audio mixer, such as an audio track, bus, FX or instrument output channel.
+type Channel struct {
+	ID string
+	// Type is the element name of the channel, such as AudioTrackChannel or AudioGroupChannel
+	Type    string
+	Label   string
+	Inserts []*Device
+
+	// Track is set for channels that belong to a track in the song
+	Track *Track
+	// Instrument is set for the output channels of instruments
+	Instrument *Instrument
+}
+
+// Device is a plugin instance with the preset it was saved with.
+type Device struct {
+	ClassID        string
+	Name           string
+	UID            string
+	Category       string
+	SubCategory    string
+	BaseName       string
+	PresetPath     string
+	PresetFileName string
+}
+
+type Instrument struct {
+	Device
+	// ID identifies the instrument in the routing, it is shared with the output channel of the instrument
+	ID string
+
+	// Channel is the mixer output channel of the instrument
+	Channel *Channel
+	// Connections route music track channels to the instrument, including those whose track doesn't exist
+	Connections []*Connection
+	Tracks      []*Track
+}
+
+// Connection routes the music track channel of a track to the input of an instrument.
+type Connection struct {
+	TrackChannelID string
+	InstrumentID   string
+
+	Track      *Track
+	Instrument *Instrument
+}
+
+// New links the parts of a song together. References to parts that don't exist are left nil.
+func New(folders []*Folder, tracks []*Track, channels []*Channel, instruments []*Instrument, connections []*Connection) *Song {
+	s := &Song{
+		Folders:           folders,
+		Tracks:            tracks,
+		Channels:          channels,
+		Instruments:       instruments,
+		Connections:       connections,
+		foldersByID:       make(map[string]*Folder),
+		tracksByID:        make(map[string]*Track),
+		tracksByChannelID: make(map[string]*Track),
+		channelsByID:      make(map[string]*Channel),
+		instrumentsByID:   make(map[string]*Instrument),
+	}
+
+	for _, folder := range folders {
+		s.foldersByID[folder.ID] = folder
+	}
+	for _, track := range tracks {
+		s.tracksByID[track.ID] = track
+		s.tracksByChannelID[track.ChannelID] = track
+	}
+	for _, channel := range channels {
+		s.channelsByID[channel.ID] = channel
+	}
+	for _, instrument := range instruments {
+		s.instrumentsByID[instrument.ID] = instrument
+	}
+
+	for _, folder := range folders {
+		if parent, ok := s.foldersByID[folder.ParentID]; ok && parent != folder {
+			folder.Parent = parent
+			parent.Folders = append(parent.Folders, folder)
+		}
+	}
+
+	for _, track := range tracks {
+		if folder, ok := s.foldersByID[track.FolderID]; ok {
+			track.Folder = folder
+			folder.Tracks = append(folder.Tracks, track)
+		}
+		if channel, ok := s.channelsByID[track.ChannelID]; ok {
+			track.Channel = channel
+			channel.Track = track
+		}
+	}
+
+	for _, instrument := range instruments {
+		if channel, ok := s.channelsByID[instrument.ID]; ok {
+			instrument.Channel = channel
+			channel.Instrument = instrument
+		}
+	}
+
+	for _, connection := range connections {
+		connection.Track = s.tracksByChannelID[connection.TrackChannelID]
+		connection.Instrument = s.instrumentsByID[connection.InstrumentID]
+
+		if connection.Instrument != nil {
+			connection.Instrument.Connections = append(connection.Instrument.Connections, connection)
+		}
+		if connection.Track != nil && connection.Instrument != nil {
+			connection.Track.Instrument = connection.Instrument
+			connection.Instrument.Tracks = append(connection.Instrument.Tracks, connection.Track)
+		}
+	}
+
+	return s
+}
+
+func (s *Song) Folder(id string) (*Folder, bool) {
+	folder, ok := s.foldersByID[id]
+	return folder, ok
+}
+
+func (s *Song) Track(id string) (*Track, bool) {
+	track, ok := s.tracksByID[id]
+	return track, ok
+}
+
+// TrackByChannelID looks up a track by the ID of its channel.
+func (s *Song) TrackByChannelID(channelID string) (*Track, bool) {
+	track, ok := s.tracksByChannelID[channelID]
+	return track, ok
+}
+
+func (s *Song) Channel(id string) (*Channel, bool) {
+	channel, ok := s.channelsByID[id]
+	return channel, ok
+}
+
+func (s *Song) Instrument(id string) (*Instrument, bool) {
+	instrument, ok := s.instrumentsByID[id]
+	return instrument, ok
+}
+
+// Connection returns the connection routing the music track channel to an instrument.
+func (s *Song) Connection(trackChannelID string) (*Connection, bool) {
+	for _, connection := range s.Connections {
+		if connection.TrackChannelID == trackChannelID {
+			return connection, true
+		}
+	}
+	return nil, false
+}
+
+// RootFolders returns the folders that are not inside another folder, sorted by name.
+func (s *Song) RootFolders() []*Folder {
+	var folders []*Folder
+	for _, folder := range s.Folders {
+		if folder.Parent == nil {
+			folders = append(folders, folder)
+		}
+	}
+
+	sort.SliceStable(folders, func(i, j int) bool {
+		return folders[i].Name < folders[j].Name
+	})
+
+	return folders
+}
+
+// RootTracks returns the tracks that are not inside a folder.
+func (s *Song) RootTracks() []*Track {
+	var tracks []*Track
+	for _, track := range s.Tracks {
+		if track.Folder == nil {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks
+}
+
+// InstrumentTracks returns the tracks that are routed to an instrument.
+func (s *Song) InstrumentTracks() []*Track {
+	var tracks []*Track
+	for _, track := range s.Tracks {
+		if track.Instrument != nil {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks
+}
+
+// Walk visits every folder depth first, starting at the root folders, and then the tracks outside any folder.
+// Returning false from a callback skips the contents of that folder.
+func (s *Song) Walk(visitFolder func(folder *Folder, depth int) bool, visitTrack func(track *Track, depth int)) {
+	for _, folder := range s.RootFolders() {
+		folder.walk(0, visitFolder, visitTrack, make(map[*Folder]bool))
+	}
+	for _, track := range s.RootTracks() {
+		visitTrack(track, 0)
+	}
+}
+
+func (f *Folder) walk(depth int, visitFolder func(folder *Folder, depth int) bool, visitTrack func(track *Track, depth int), visited map[*Folder]bool) {
+	if visited[f] {
+		return
+	}
+	visited[f] = true
+
+	if !visitFolder(f, depth) {
+		return
+	}
+
+	children := append([]*Folder{}, f.Folders...)
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+
+	for _, child := range children {
+		child.walk(depth+1, visitFolder, visitTrack, visited)
+	}
+	for _, track := range f.Tracks {
+		visitTrack(track, depth+1)
+	}
+}
+
+// Ancestors returns the parent folders from the root down to the direct parent.
+func (f *Folder) Ancestors() []*Folder {
+	var ancestors []*Folder
+	visited := map[*Folder]bool{f: true}
+
+	for parent := f.Parent; parent != nil && !visited[parent]; parent = parent.Parent {
+		visited[parent] = true
+		ancestors = append([]*Folder{parent}, ancestors...)
+	}
+
+	return ancestors
+}
+
+// Path returns the slash separated names of the folder and its parents, as in "Synths/Pads".
+func (f *Folder) Path() string {
+	var names []string
+	for _, ancestor := range f.Ancestors() {
+		names = append(names, ancestor.Name)
+	}
+	return strings.Join(append(names, f.Name), "/")
+}
+
+// Path returns the folder path of the track, empty for tracks outside any folder.
+func (t *Track) Path() string {
+	if t.Folder == nil {
+		return ""
+	}
+	return t.Folder.Path()
+}
@@ -0,0 +1,49 @@
+package song
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the version of the application that saved a song, as recorded in its metainfo.xml.
+type Version struct {
+	// Generator is the raw Document:Generator value, such as "Studio One/6.5.2.97440"
+	Generator   string
+	Application string
+	Major       int
+	Minor       int
+	Patch       int
+	Build       int
+}
+
+// ParseVersion parses a Document:Generator value of the form "<application>/<major>.<minor>.<patch>.<build>", the
+// minor, patch and build numbers are optional.
+func ParseVersion(generator string) (*Version, error) {
+	application, number, ok := strings.Cut(generator, "/")
+	if !ok {
+		return nil, fmt.Errorf("Invalid generator %q, expected the application and version separated by /", generator)
+	}
+
+	version := &Version{Generator: generator, Application: application}
+
+	parts := strings.Split(number, ".")
+	if len(parts) > 4 {
+		return nil, fmt.Errorf("Invalid version %q in generator %q", number, generator)
+	}
+
+	fields := []*int{&version.Major, &version.Minor, &version.Patch, &version.Build}
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("Invalid version %q in generator %q", number, generator)
+		}
+		*fields[i] = value
+	}
+
+	return version, nil
+}
+
+func (v *Version) String() string {
+	return fmt.Sprintf("%s %d.%d.%d.%d", v.Application, v.Major, v.Minor, v.Patch, v.Build)
+}
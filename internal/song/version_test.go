@@ -0,0 +1,63 @@
+package song
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		generator string
+		want      Version
+	}{
+		{"Studio One/6.5.2.97440", Version{Application: "Studio One", Major: 6, Minor: 5, Patch: 2, Build: 97440}},
+		{"Studio One/5.5.2", Version{Application: "Studio One", Major: 5, Minor: 5, Patch: 2}},
+		{"Studio One/7", Version{Application: "Studio One", Major: 7}},
+		{"Studio One Pro/7.0.1.104562", Version{Application: "Studio One Pro", Major: 7, Minor: 0, Patch: 1, Build: 104562}},
+		{"Cubase/13.0.10", Version{Application: "Cubase", Major: 13, Patch: 10}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.generator, func(t *testing.T) {
+			version, err := ParseVersion(test.generator)
+			if err != nil {
+				t.Fatalf("ParseVersion(%q) returned error: %s", test.generator, err)
+			}
+
+			test.want.Generator = test.generator
+			if *version != test.want {
+				t.Errorf("ParseVersion(%q) = %+v, want %+v", test.generator, *version, test.want)
+			}
+		})
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"garbage",
+		"Studio One 6.5",
+		"Studio One/",
+		"Studio One/x.y",
+		"Studio One/6.5.x",
+		"Studio One/6..2",
+		"Studio One/-6",
+		"Studio One/6.5.2.97440.1",
+	}
+
+	for _, generator := range tests {
+		t.Run(generator, func(t *testing.T) {
+			if version, err := ParseVersion(generator); err == nil {
+				t.Errorf("ParseVersion(%q) = %+v, want an error", generator, *version)
+			}
+		})
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	version, err := ParseVersion("Studio One/7")
+	if err != nil {
+		t.Fatalf("ParseVersion returned error: %s", err)
+	}
+
+	if got, want := version.String(), "Studio One 7.0.0.0"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package writer
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const ManifestFileName = ".studio-one-preset-tool.json"
+
+type ManifestEntry struct {
+	SourceSong string `json:"sourceSong"`
+	SongID     string `json:"songId"`
+	TrackID    string `json:"trackId"`
+	// Hash is the SHA-256 hash of the entries of the package, its metadata and raw preset data
+	Hash string `json:"hash"`
+	// Path is relative to the output directory
+	Path string `json:"path"`
+}
+
+// Manifest records every package this tool generated in an output directory, so later runs can tell their own
+// files apart from hand-made ones and skip presets that did not change.
+type Manifest struct {
+	Entries []*ManifestEntry `json:"entries"`
+}
+
+// manifestMu serializes manifest updates, as songs in a batch can share an output directory.
+var manifestMu sync.Mutex
+
+// updateManifest replaces the entries of one song in the manifest of the output directory, leaving the entries of
+// other songs untouched.
+func updateManifest(outPath string, sourceSong string, entries []*ManifestEntry, logger *slog.Logger) error {
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+
+	manifest, err := loadManifest(outPath, logger)
+	if err != nil {
+		return err
+	}
+
+	updated := &Manifest{}
+	for _, entry := range manifest.Entries {
+		if entry.SourceSong != sourceSong {
+			updated.Entries = append(updated.Entries, entry)
+		}
+	}
+	updated.Entries = append(updated.Entries, entries...)
+
+	sort.Slice(updated.Entries, func(i, j int) bool {
+		if updated.Entries[i].SourceSong != updated.Entries[j].SourceSong {
+			return updated.Entries[i].SourceSong < updated.Entries[j].SourceSong
+		}
+		return updated.Entries[i].Path < updated.Entries[j].Path
+	})
+
+	return updated.save(outPath)
+}
+
+// loadManifest reads the manifest of the output directory. A manifest that can't be parsed, such as one left behind by
+// a crash on an older version, is treated as empty: nothing in the directory is known to be generated then.
+func loadManifest(outPath string, logger *slog.Logger) (*Manifest, error) {
+	content, err := os.ReadFile(path.Join(outPath, ManifestFileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &Manifest{}, nil
+		}
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		logger.Warn("Ignoring corrupt manifest, no existing presets are known to be generated", "manifest", path.Join(outPath, ManifestFileName), "error", err)
+		return &Manifest{}, nil
+	}
+
+	return &manifest, nil
+}
+
+func (m *Manifest) save(outPath string) error {
+	if err := os.MkdirAll(outPath, os.ModePerm); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Written atomically, an interrupted run leaves the previous manifest rather than a truncated one
+	return file.WriteFileAtomic(path.Join(outPath, ManifestFileName), content)
+}
+
+// bySource returns the entries generated from one song, keyed by the identity of the package.
+func (m *Manifest) bySource(sourceSong string) map[string]*ManifestEntry {
+	entries := make(map[string]*ManifestEntry)
+
+	for _, entry := range m.Entries {
+		if entry.SourceSong == sourceSong {
+			entries[entry.key()] = entry
+		}
+	}
+
+	return entries
+}
+
+// ownersExcept returns the song of every path generated from another song, keyed by the lower-cased path.
+func (m *Manifest) ownersExcept(sourceSong string) map[string]string {
+	owners := make(map[string]string)
+
+	for _, entry := range m.Entries {
+		if entry.SourceSong != sourceSong {
+			owners[strings.ToLower(entry.Path)] = entry.SourceSong
+		}
+	}
+
+	return owners
+}
+
+// key identifies a package across runs. The output path is not part of it, as that changes when a track is renamed
+// or moved.
+func (e *ManifestEntry) key() string {
+	return packageKey(e.SourceSong, e.SongID, path.Ext(e.Path))
+}
+
+func packageKey(sourceSong string, songID string, ext string) string {
+	return sourceSong + "|" + songID + "|" + ext
+}
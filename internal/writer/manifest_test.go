@@ -0,0 +1,92 @@
+package writer
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name    string
+		content string
+		entries int
+	}{
+		{"missing", "", 0},
+		{"valid", `{"entries": [{"sourceSong": "/songs/Demo.song", "songId": "A", "path": "Lead.instrument"}]}`, 1},
+		{"truncated", `{"entries": [{"sourceSong": "/songs/Demo.song"`, 0},
+		{"not json", "garbage", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outPath := t.TempDir()
+			if test.content != "" {
+				if err := os.WriteFile(path.Join(outPath, ManifestFileName), []byte(test.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			manifest, err := loadManifest(outPath, logger)
+			if err != nil {
+				t.Fatalf("loadManifest returned error: %s", err)
+			}
+			if len(manifest.Entries) != test.entries {
+				t.Errorf("loadManifest returned %d entries, want %d", len(manifest.Entries), test.entries)
+			}
+		})
+	}
+}
+
+func TestUpdateManifest(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	outPath := t.TempDir()
+
+	demo := "/songs/Demo.song"
+	other := "/songs/Other.song"
+
+	updates := []struct {
+		sourceSong string
+		entries    []*ManifestEntry
+	}{
+		{demo, []*ManifestEntry{{SourceSong: demo, SongID: "A", Path: "Lead.instrument"}, {SourceSong: demo, SongID: "B", Path: "Pad.instrument"}}},
+		{other, []*ManifestEntry{{SourceSong: other, SongID: "A", Path: "Bass.instrument"}}},
+		// The entries of a song replace its earlier ones
+		{demo, []*ManifestEntry{{SourceSong: demo, SongID: "A", Path: "Lead.instrument"}}},
+	}
+	for _, update := range updates {
+		if err := updateManifest(outPath, update.sourceSong, update.entries, logger); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest, err := loadManifest(outPath, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(manifest.bySource(demo)); got != 1 {
+		t.Errorf("%s has %d entries, want 1", demo, got)
+	}
+	if _, ok := manifest.bySource(demo)[packageKey(demo, "A", ".instrument")]; !ok {
+		t.Errorf("%s has no entry for track A", demo)
+	}
+
+	owners := manifest.ownersExcept(demo)
+	if len(owners) != 1 || owners["bass.instrument"] != other {
+		t.Errorf("ownersExcept = %v, want bass.instrument owned by %s", owners, other)
+	}
+
+	// Nothing but the manifest is left behind by the atomic writes
+	files, err := os.ReadDir(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != ManifestFileName {
+		t.Errorf("Output directory holds %d files, want only the manifest", len(files))
+	}
+}
@@ -0,0 +1,584 @@
+package writer
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/config"
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type ActionKind string
+
+const (
+	ActionCreate    ActionKind = "create"
+	ActionOverwrite ActionKind = "overwrite"
+	ActionDelete    ActionKind = "delete"
+	ActionSkip      ActionKind = "skip"
+	ActionUnchanged ActionKind = "unchanged"
+)
+
+type Action struct {
+	Kind ActionKind
+	// Path is relative to the output directory
+	Path string
+	Size int64
+	// Differs reports whether the new content differs from the file already on disk
+	Differs bool
+	pkg     *stagedPackage
+}
+
+type Plan struct {
+	Actions []*Action
+	// Collisions are the packages that were renamed because another package has the same path
+	Collisions []*Collision
+	sourceSong string
+	// entries are the manifest entries of the song once the plan has been applied
+	entries []*ManifestEntry
+}
+
+// Collision records a package that was given a numbered name, because an earlier package of the song, a package of
+// another song or a file that was not generated already uses its path.
+type Collision struct {
+	Path      string
+	RenamedTo string
+	SongID    string
+	// Owner is the other song whose package has the path
+	Owner string
+	// Existing is set when a file in the output directory that was not generated has the path
+	Existing bool
+}
+
+// Reason describes why the package was renamed.
+func (c *Collision) Reason() string {
+	switch {
+	case c.Existing:
+		return "a file that was not generated has this path"
+	case c.Owner != "":
+		return fmt.Sprintf("%s has a preset with this path", c.Owner)
+	default:
+		return "another preset of the song has this path"
+	}
+}
+
+type stagedPackage struct {
+	// Path is relative to the output directory
+	Path string
+	// Data is the complete package archive
+	Data    []byte
+	SongID  string
+	TrackID string
+	// Hash is the hash of the entries of the package, its metadata and raw preset data
+	Hash string
+}
+
+func (p *stagedPackage) key(sourceSong string) string {
+	return packageKey(sourceSong, p.SongID, path.Ext(p.Path))
+}
+
+// Count returns the number of actions of the given kind.
+func (p *Plan) Count(kind ActionKind) int {
+	count := 0
+	for _, action := range p.Actions {
+		if action.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// RenamedFrom returns the path a package would have had if it had not been renamed, or an empty string when the
+// package at path was not renamed.
+func (p *Plan) RenamedFrom(path string) string {
+	original := ""
+	for {
+		var found *Collision
+		for _, collision := range p.Collisions {
+			if collision.RenamedTo == path {
+				found = collision
+			}
+		}
+		if found == nil {
+			return original
+		}
+		original = found.Path
+		path = found.Path
+	}
+}
+
+// Find returns the action for the package built from a track or channel, ext selects the kind of package such as
+// ".instrument".
+func (p *Plan) Find(songID string, ext string) *Action {
+	for _, action := range p.Actions {
+		if action.pkg != nil && action.pkg.SongID == songID && path.Ext(action.pkg.Path) == ext {
+			return action
+		}
+	}
+	return nil
+}
+
+// Build holds the packages of a song built in memory, ready to be planned once.
+type Build struct {
+	packages []*stagedPackage
+}
+
+// Plan builds every package in memory and works out which files in the output directory would be
+// created, overwritten or deleted. Nothing in the output directory is touched.
+func (s *Service) Plan(presetMap *reader.PresetMap, fxChainMap *reader.FXChainMap) (*Plan, error) {
+	build, err := s.Build(presetMap, fxChainMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.PlanBuild(build)
+}
+
+// Build builds every package in memory without looking at the output directory. Songs sharing an output directory
+// can be built at the same time and planned one after the other with PlanBuild.
+func (s *Service) Build(presetMap *reader.PresetMap, fxChainMap *reader.FXChainMap) (*Build, error) {
+	packages, err := s.buildPackages(presetMap, fxChainMap)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Build{packages: packages}, nil
+}
+
+// PlanBuild works out which files in the output directory the packages of a Build would create, overwrite or delete.
+func (s *Service) PlanBuild(build *Build) (*Plan, error) {
+	return s.planPackages(build.packages)
+}
+
+// planPackages works out the actions for packages built in memory.
+func (s *Service) planPackages(packages []*stagedPackage) (*Plan, error) {
+	sortPackages(packages)
+
+	// A clean slate starts with an empty manifest
+	manifest := &Manifest{}
+	if !s.cfg.RemoveExistingOut {
+		var err error
+		manifest, err = loadManifest(s.cfg.Out.Path, s.logger)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading manifest: %w", err)
+		}
+	}
+
+	sourceSong := s.cfg.In.Full
+	previous := manifest.bySource(sourceSong)
+
+	// Every path the song generated before is ours to replace, whichever of its packages it belonged to
+	owned := make(map[string]bool)
+	for _, entry := range previous {
+		owned[entry.Path] = true
+	}
+
+	// Songs sharing the output directory must not overwrite each other's presets
+	collisions, err := s.dedupePaths(packages, sourceSong, previous, manifest.ownersExcept(sourceSong))
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Collisions: collisions}
+	planned := make(map[string]bool)
+	current := make(map[string]bool)
+
+	// Renamed packages must not take the path of another package, which may come later in the plan
+	reserved := make(map[string]bool)
+	for _, pkg := range packages {
+		reserved[strings.ToLower(pkg.Path)] = true
+	}
+
+	for _, pkg := range packages {
+		key := pkg.key(sourceSong)
+		current[key] = true
+
+		action, err := s.planPackage(pkg, planned, reserved, owned, previous[key])
+		if err != nil {
+			return nil, err
+		}
+		if action.Path != pkg.Path {
+			plan.Collisions = append(plan.Collisions, &Collision{
+				Path:      pkg.Path,
+				RenamedTo: action.Path,
+				SongID:    pkg.SongID,
+				Existing:  true,
+			})
+		}
+
+		planned[action.Path] = true
+		plan.Actions = append(plan.Actions, action)
+	}
+
+	var kept []*ManifestEntry
+	for key, entry := range previous {
+		// Presets whose track no longer exists are only removed when pruning
+		if !current[key] && !s.cfg.Prune {
+			kept = append(kept, entry)
+			continue
+		}
+
+		// Remove what was generated before at a path that is no longer used, e.g. after a track was renamed
+		if planned[entry.Path] {
+			continue
+		}
+		exists, err := s.exists(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+		action, err := s.planDelete(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+		planned[action.Path] = true
+		plan.Actions = append(plan.Actions, action)
+	}
+
+	if s.cfg.RemoveExistingOut {
+		deletes, err := s.planDeletes(planned)
+		if err != nil {
+			return nil, err
+		}
+		plan.Actions = append(plan.Actions, deletes...)
+	}
+
+	sort.Slice(plan.Actions, func(i, j int) bool {
+		return plan.Actions[i].Path < plan.Actions[j].Path
+	})
+
+	plan.sourceSong = sourceSong
+	plan.entries = s.buildManifestEntries(sourceSong, plan.Actions, kept)
+
+	return plan, nil
+}
+
+// Apply carries out a plan created by Plan. The output directory is only cleared when RemoveExistingOut is set,
+// otherwise the packages are merged into it.
+func (s *Service) Apply(plan *Plan) error {
+	if s.cfg.RemoveExistingOut {
+		if err := os.RemoveAll(s.cfg.Out.Path); err != nil {
+			return err
+		}
+	}
+
+	for _, action := range plan.Actions {
+		// Every file is written atomically, so stopping in between leaves a consistent output directory
+		if err := s.ctx.Err(); err != nil {
+			return err
+		}
+
+		switch action.Kind {
+		case ActionSkip, ActionUnchanged:
+			continue
+		case ActionDelete:
+			if s.cfg.RemoveExistingOut {
+				continue
+			}
+			if err := os.Remove(path.Join(s.cfg.Out.Path, action.Path)); err != nil {
+				return err
+			}
+			s.logger.Info(fmt.Sprintf("Deleted %s", action.Path))
+			continue
+		}
+
+		dst := path.Join(s.cfg.Out.Path, action.Path)
+		if err := os.MkdirAll(path.Dir(dst), os.ModePerm); err != nil {
+			return err
+		}
+
+		// Written to a temp file and renamed into place, so an interrupted run never leaves a half-written package
+		if err := file.WriteFileAtomic(dst, action.pkg.Data); err != nil {
+			return err
+		}
+
+		s.logger.Info(fmt.Sprintf("Created %s", action.Path))
+	}
+
+	if err := updateManifest(s.cfg.Out.Path, plan.sourceSong, plan.entries, s.logger); err != nil {
+		return fmt.Errorf("Error writing manifest: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Service) planPackage(pkg *stagedPackage, planned map[string]bool, reserved map[string]bool, owned map[string]bool, previous *ManifestEntry) (*Action, error) {
+	action := &Action{
+		Kind:    ActionCreate,
+		Path:    pkg.Path,
+		Size:    int64(len(pkg.Data)),
+		Differs: true,
+		pkg:     pkg,
+	}
+
+	exists, err := s.exists(pkg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A clean slate has no conflicts, everything that is there gets replaced
+	if exists && !owned[pkg.Path] && !s.cfg.RemoveExistingOut {
+		switch s.cfg.OnConflict {
+		case config.ConflictPolicySkip:
+			action.Kind = ActionSkip
+			return action, nil
+		case config.ConflictPolicyFail:
+			return nil, fmt.Errorf("%s already exists in the output directory", pkg.Path)
+		case config.ConflictPolicyRename:
+			renamed, err := uniquePath(pkg.Path, func(p string) (bool, error) {
+				if planned[p] || reserved[strings.ToLower(p)] {
+					return true, nil
+				}
+				if owned[p] {
+					return false, nil
+				}
+				return s.exists(p)
+			})
+			if err != nil {
+				return nil, err
+			}
+			action.Path = renamed
+
+			exists, err = s.exists(renamed)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !exists {
+		return action, nil
+	}
+
+	if previous != nil && previous.Path == action.Path && previous.Hash == pkg.Hash {
+		action.Kind = ActionUnchanged
+		action.Differs = false
+		return action, nil
+	}
+
+	action.Kind = ActionOverwrite
+
+	// An existing file that can't be read as a package is treated as different
+	equal, err := file.ZipContentsEqual(pkg.Data, path.Join(s.cfg.Out.Path, action.Path))
+	action.Differs = err != nil || !equal
+
+	return action, nil
+}
+
+// sortPackages orders packages by path and source track. Packages are built concurrently, sorting them keeps renames
+// deterministic.
+func sortPackages(packages []*stagedPackage) {
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Path != packages[j].Path {
+			return packages[i].Path < packages[j].Path
+		}
+		return packages[i].SongID < packages[j].SongID
+	})
+}
+
+// dedupePaths renames packages whose path is already used by an earlier package or by another song, as in
+// "Bass (2).instrument". owners maps the lower-cased paths of other songs in the output directory to those songs.
+// Paths are compared case insensitively, as they collide on Windows and macOS.
+//
+// Packages keep the path previous runs gave them, so adding a track with the name of an existing one numbers the new
+// preset instead of shuffling the numbers of the existing ones.
+func (s *Service) dedupePaths(packages []*stagedPackage, sourceSong string, previous map[string]*ManifestEntry, owners map[string]string) ([]*Collision, error) {
+	var collisions []*Collision
+	used := make(map[string]bool)
+
+	taken := func(p string) bool {
+		_, owned := owners[strings.ToLower(p)]
+		return used[strings.ToLower(p)] || owned
+	}
+
+	// A numbered path is only kept while another package or song still has the plain one
+	shared := make(map[string]int)
+	for _, pkg := range packages {
+		shared[strings.ToLower(pkg.Path)]++
+	}
+
+	kept := make(map[*stagedPackage]bool)
+	for _, pkg := range packages {
+		entry := previous[pkg.key(sourceSong)]
+		if entry == nil || taken(entry.Path) {
+			continue
+		}
+
+		_, owned := owners[strings.ToLower(pkg.Path)]
+		if entry.Path == pkg.Path || (isNumbered(entry.Path, pkg.Path) && (shared[strings.ToLower(pkg.Path)] > 1 || owned)) {
+			kept[pkg] = true
+			used[strings.ToLower(entry.Path)] = true
+		}
+	}
+
+	for _, pkg := range packages {
+		var renamed string
+
+		if kept[pkg] {
+			renamed = previous[pkg.key(sourceSong)].Path
+		} else if taken(pkg.Path) {
+			var err error
+			renamed, err = uniquePath(pkg.Path, func(p string) (bool, error) {
+				return taken(p), nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if renamed != "" && renamed != pkg.Path {
+			var owner string
+			if shared[strings.ToLower(pkg.Path)] > 1 || used[strings.ToLower(pkg.Path)] {
+				s.logger.Warn("Renamed preset with a duplicate name", "path", pkg.Path, "renamed", renamed)
+			} else {
+				owner = owners[strings.ToLower(pkg.Path)]
+				s.logger.Warn("Renamed preset whose path belongs to another song", "path", pkg.Path, "renamed", renamed, "owner", owner)
+			}
+			collisions = append(collisions, &Collision{
+				Path:      pkg.Path,
+				RenamedTo: renamed,
+				SongID:    pkg.SongID,
+				Owner:     owner,
+			})
+			pkg.Path = renamed
+		}
+
+		used[strings.ToLower(pkg.Path)] = true
+	}
+
+	return collisions, nil
+}
+
+// isNumbered reports whether p is original with a counter appended by uniquePath, as in "Bass (2).instrument".
+func isNumbered(p string, original string) bool {
+	ext := path.Ext(original)
+	prefix := strings.TrimSuffix(original, ext) + " ("
+	suffix := ")" + ext
+
+	if !strings.HasPrefix(p, prefix) || !strings.HasSuffix(p, suffix) || len(p) <= len(prefix)+len(suffix) {
+		return false
+	}
+
+	counter, err := strconv.Atoi(p[len(prefix) : len(p)-len(suffix)])
+	return err == nil && counter >= 2
+}
+
+func (s *Service) planDelete(relPath string) (*Action, error) {
+	info, err := os.Stat(path.Join(s.cfg.Out.Path, relPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Action{
+		Kind: ActionDelete,
+		Path: relPath,
+		Size: info.Size(),
+	}, nil
+}
+
+// planDeletes lists every file in the output directory that is not part of the plan, as the output directory is
+// cleared before writing.
+func (s *Service) planDeletes(planned map[string]bool) ([]*Action, error) {
+	var actions []*Action
+
+	err := filepath.WalkDir(s.cfg.Out.Path, func(pathname string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.cfg.Out.Path, pathname)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		// The manifest is rewritten rather than deleted
+		if planned[rel] || rel == ManifestFileName {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		actions = append(actions, &Action{
+			Kind: ActionDelete,
+			Path: rel,
+			Size: info.Size(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// buildManifestEntries returns the manifest entries of the song as they will be after the plan has been applied.
+func (s *Service) buildManifestEntries(sourceSong string, actions []*Action, kept []*ManifestEntry) []*ManifestEntry {
+	entries := append([]*ManifestEntry{}, kept...)
+
+	for _, action := range actions {
+		if action.pkg == nil || action.Kind == ActionSkip {
+			continue
+		}
+
+		entries = append(entries, &ManifestEntry{
+			SourceSong: sourceSong,
+			SongID:     action.pkg.SongID,
+			TrackID:    action.pkg.TrackID,
+			Hash:       action.pkg.Hash,
+			Path:       action.Path,
+		})
+	}
+
+	return entries
+}
+
+// exists reports whether a path relative to the output directory is already on disk.
+func (s *Service) exists(relPath string) (bool, error) {
+	_, err := os.Stat(path.Join(s.cfg.Out.Path, relPath))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// uniquePath appends a counter to the file name, as in "Bass (2).instrument", until taken reports it as free.
+func uniquePath(p string, taken func(string) (bool, error)) (string, error) {
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+
+		isTaken, err := taken(candidate)
+		if err != nil {
+			return "", err
+		}
+		if !isTaken {
+			return candidate, nil
+		}
+	}
+}
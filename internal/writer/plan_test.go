@@ -0,0 +1,354 @@
+package writer
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/config"
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"testing"
+)
+
+func newTestService(t *testing.T, outPath string) *Service {
+	t.Helper()
+
+	cfg := &config.Config{OnConflict: config.ConflictPolicyRename, Jobs: 1}
+	cfg.In.Full = "/songs/Demo.song"
+	cfg.Out.Path = outPath
+
+	return NewService(cfg, context.Background(), slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+}
+
+func newTestPackage(t *testing.T, packagePath string, songID string, content string) *stagedPackage {
+	t.Helper()
+
+	data, err := file.CompressEntries([]file.ArchiveEntry{{Name: "preset", Data: []byte(content)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &stagedPackage{Path: packagePath, Data: data, SongID: songID, Hash: file.Hash(data)}
+}
+
+// actionsByPath maps the paths of a plan to their action kinds.
+func actionsByPath(plan *Plan) map[string]ActionKind {
+	kinds := make(map[string]ActionKind)
+	for _, action := range plan.Actions {
+		kinds[action.Path] = action.Kind
+	}
+	return kinds
+}
+
+func TestPlanDuplicateNames(t *testing.T) {
+	s := newTestService(t, t.TempDir())
+
+	plan, err := s.planPackages([]*stagedPackage{
+		newTestPackage(t, "Synths/bass.instrument", "C", "c"),
+		newTestPackage(t, "Synths/Bass.instrument", "B", "b"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]ActionKind{
+		"Synths/Bass.instrument":     ActionCreate,
+		"Synths/bass (2).instrument": ActionCreate,
+	}
+	assertActions(t, plan, want)
+
+	if len(plan.Collisions) != 1 || plan.Collisions[0].Reason() != "another preset of the song has this path" {
+		t.Errorf("Collisions = %+v, want one rename of a duplicate name", plan.Collisions)
+	}
+}
+
+func TestPlanKeepsNumberedNames(t *testing.T) {
+	outPath := t.TempDir()
+	s := newTestService(t, outPath)
+
+	plan, err := s.planPackages([]*stagedPackage{
+		newTestPackage(t, "Synths/Bass.instrument", "B", "b"),
+		newTestPackage(t, "Synths/bass.instrument", "C", "c"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Apply(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new track named Bass whose ID sorts first must not take the names of the existing presets
+	plan, err = s.planPackages([]*stagedPackage{
+		newTestPackage(t, "Synths/Bass.instrument", "A", "a"),
+		newTestPackage(t, "Synths/Bass.instrument", "B", "b"),
+		newTestPackage(t, "Synths/bass.instrument", "C", "c"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]ActionKind{
+		"Synths/Bass.instrument":     ActionUnchanged,
+		"Synths/bass (2).instrument": ActionUnchanged,
+		"Synths/Bass (3).instrument": ActionCreate,
+	}
+	assertActions(t, plan, want)
+
+	for _, collision := range plan.Collisions {
+		if collision.Existing {
+			t.Errorf("%s was renamed to %s as a file that was not generated, but the song generated it", collision.Path, collision.RenamedTo)
+		}
+	}
+	if from := plan.RenamedFrom("Synths/Bass (3).instrument"); from != "Synths/Bass.instrument" {
+		t.Errorf("RenamedFrom = %q, want Synths/Bass.instrument", from)
+	}
+}
+
+func TestPlanMovesBackToPlainName(t *testing.T) {
+	outPath := t.TempDir()
+	s := newTestService(t, outPath)
+
+	plan, err := s.planPackages([]*stagedPackage{
+		newTestPackage(t, "Synths/Bass.instrument", "A", "a"),
+		newTestPackage(t, "Synths/Bass.instrument", "B", "b"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Apply(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the other Bass track the numbered name is no longer needed
+	s.cfg.Prune = true
+	plan, err = s.planPackages([]*stagedPackage{
+		newTestPackage(t, "Synths/Bass.instrument", "B", "b"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]ActionKind{
+		"Synths/Bass.instrument":     ActionOverwrite,
+		"Synths/Bass (2).instrument": ActionDelete,
+	}
+	assertActions(t, plan, want)
+}
+
+func TestPlanConflicts(t *testing.T) {
+	tests := []struct {
+		policy config.ConflictPolicy
+		want   map[string]ActionKind
+	}{
+		{config.ConflictPolicyRename, map[string]ActionKind{"Lead (2).instrument": ActionCreate}},
+		{config.ConflictPolicySkip, map[string]ActionKind{"Lead.instrument": ActionSkip}},
+		{config.ConflictPolicyOverwrite, map[string]ActionKind{"Lead.instrument": ActionOverwrite}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			outPath := t.TempDir()
+			if err := os.WriteFile(path.Join(outPath, "Lead.instrument"), []byte("made by hand"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			s := newTestService(t, outPath)
+			s.cfg.OnConflict = test.policy
+
+			plan, err := s.planPackages([]*stagedPackage{newTestPackage(t, "Lead.instrument", "A", "a")})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.policy == config.ConflictPolicyRename {
+				if len(plan.Collisions) != 1 || !plan.Collisions[0].Existing {
+					t.Errorf("Collisions = %+v, want one rename for an existing file", plan.Collisions)
+				}
+			}
+			assertActions(t, plan, test.want)
+		})
+	}
+
+	t.Run(string(config.ConflictPolicyFail), func(t *testing.T) {
+		outPath := t.TempDir()
+		if err := os.WriteFile(path.Join(outPath, "Lead.instrument"), []byte("made by hand"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		s := newTestService(t, outPath)
+		s.cfg.OnConflict = config.ConflictPolicyFail
+
+		if _, err := s.planPackages([]*stagedPackage{newTestPackage(t, "Lead.instrument", "A", "a")}); err == nil {
+			t.Error("planPackages succeeded, want an error for the existing file")
+		}
+	})
+}
+
+func TestPlanOtherSong(t *testing.T) {
+	outPath := t.TempDir()
+
+	other := newTestService(t, outPath)
+	other.cfg.In.Full = "/songs/Other.song"
+	plan, err := other.planPackages([]*stagedPackage{newTestPackage(t, "Bass.instrument", "A", "other")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Apply(plan); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestService(t, outPath)
+	for run := 0; run < 2; run++ {
+		plan, err := s.planPackages([]*stagedPackage{newTestPackage(t, "bass.instrument", "A", "demo")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]ActionKind{"bass (2).instrument": ActionCreate}
+		if run > 0 {
+			want = map[string]ActionKind{"bass (2).instrument": ActionUnchanged}
+		}
+		assertActions(t, plan, want)
+
+		if len(plan.Collisions) != 1 || plan.Collisions[0].Owner != "/songs/Other.song" {
+			t.Errorf("Collisions = %+v, want one rename for the other song", plan.Collisions)
+		}
+
+		if err := s.Apply(plan); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPlanUnchanged(t *testing.T) {
+	outPath := t.TempDir()
+	s := newTestService(t, outPath)
+
+	for _, test := range []struct {
+		content string
+		want    ActionKind
+	}{
+		{"a", ActionCreate},
+		{"a", ActionUnchanged},
+		{"b", ActionOverwrite},
+	} {
+		plan, err := s.planPackages([]*stagedPackage{newTestPackage(t, "Lead.instrument", "A", test.content)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertActions(t, plan, map[string]ActionKind{"Lead.instrument": test.want})
+		if err := s.Apply(plan); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIsNumbered(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"Synths/Bass (2).instrument", true},
+		{"Synths/Bass (12).instrument", true},
+		{"Synths/Bass.instrument", false},
+		{"Synths/Bass (1).instrument", false},
+		{"Synths/Bass (x).instrument", false},
+		{"Synths/Bass ().instrument", false},
+		{"Synths/bass (2).instrument", false},
+		{"Synths/Bass (2).multipreset", false},
+	}
+
+	for _, test := range tests {
+		if got := isNumbered(test.path, "Synths/Bass.instrument"); got != test.want {
+			t.Errorf("isNumbered(%q) = %t, want %t", test.path, got, test.want)
+		}
+	}
+}
+
+func assertActions(t *testing.T, plan *Plan, want map[string]ActionKind) {
+	t.Helper()
+
+	got := actionsByPath(plan)
+	if len(got) != len(want) {
+		t.Errorf("Actions = %v, want %v", got, want)
+		return
+	}
+	for p, kind := range want {
+		if got[p] != kind {
+			t.Errorf("Actions = %v, want %v", got, want)
+			return
+		}
+	}
+}
+
+func TestPlanMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		removeExisting bool
+		prune          bool
+		want           map[string]ActionKind
+	}{
+		{
+			name: "merge",
+			want: map[string]ActionKind{
+				"Lead.instrument": ActionUnchanged,
+			},
+		},
+		{
+			name:  "prune",
+			prune: true,
+			want: map[string]ActionKind{
+				"Lead.instrument": ActionUnchanged,
+				"Pad.instrument":  ActionDelete,
+			},
+		},
+		{
+			name:           "remove existing",
+			removeExisting: true,
+			want: map[string]ActionKind{
+				"Lead.instrument":      ActionOverwrite,
+				"Pad.instrument":       ActionDelete,
+				"Hand made.instrument": ActionDelete,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			outPath := t.TempDir()
+			s := newTestService(t, outPath)
+
+			plan, err := s.planPackages([]*stagedPackage{
+				newTestPackage(t, "Lead.instrument", "A", "a"),
+				newTestPackage(t, "Pad.instrument", "B", "b"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Apply(plan); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path.Join(outPath, "Hand made.instrument"), []byte("made by hand"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// The Pad track was removed from the song
+			s.cfg.RemoveExistingOut = test.removeExisting
+			s.cfg.Prune = test.prune
+			plan, err = s.planPackages([]*stagedPackage{newTestPackage(t, "Lead.instrument", "A", "a")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertActions(t, plan, test.want)
+
+			if err := s.Apply(plan); err != nil {
+				t.Fatal(err)
+			}
+			_, err = os.Stat(path.Join(outPath, "Hand made.instrument"))
+			if kept := err == nil; kept == test.removeExisting {
+				t.Errorf("Hand made.instrument kept = %t, want %t", kept, !test.removeExisting)
+			}
+		})
+	}
+}
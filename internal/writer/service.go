@@ -4,140 +4,350 @@ import (
 	"bholtland/studio-one-preset-tool-go/internal/config"
 	"bholtland/studio-one-preset-tool-go/internal/file"
 	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"bholtland/studio-one-preset-tool-go/internal/sanitize"
 	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
-	"os"
 	"path"
-	"runtime"
-	"strings"
 	"sync"
 )
 
-type metaAttribute struct {
+// MetaAttribute is an attribute of the metainfo.xml or presetparts.xml of a preset package, such as Class:ID.
+type MetaAttribute struct {
 	ID    string `xml:"id,attr"`
 	Value string `xml:"value,attr"`
 }
 
-type metaInfo struct {
+// MetaInfo is the metainfo.xml of a preset package, describing the preset as a whole.
+type MetaInfo struct {
 	XMLName    xml.Name        `xml:"MetaInformation"`
-	Attributes []metaAttribute `xml:"Attribute"`
+	Attributes []MetaAttribute `xml:"Attribute"`
 }
 
-type presetParts struct {
-	XMLName    xml.Name `xml:"PresetParts"`
-	PresetPart []struct {
-		Attributes []metaAttribute `xml:"Attribute"`
-	} `xml:"PresetPart"`
+// PresetPart describes one device of a preset package and the data file with its state.
+type PresetPart struct {
+	Attributes []MetaAttribute `xml:"Attribute"`
+}
+
+// PresetParts is the presetparts.xml of a preset package.
+type PresetParts struct {
+	XMLName    xml.Name     `xml:"PresetParts"`
+	PresetPart []PresetPart `xml:"PresetPart"`
 }
 
 type Service struct {
 	cfg    *config.Config
 	ctx    context.Context
 	logger *slog.Logger
+	song   fs.FS
 }
 
-func NewService(cfg *config.Config, ctx context.Context, logger *slog.Logger) *Service {
+// NewService creates a writer that takes the raw preset data from the contents of a song, typically the opened song
+// archive.
+func NewService(cfg *config.Config, ctx context.Context, logger *slog.Logger, song fs.FS) *Service {
 	return &Service{
 		cfg:    cfg,
 		ctx:    ctx,
 		logger: logger,
+		song:   song,
 	}
 }
 
-func (s *Service) CreatePresets(presetMap *reader.PresetMap) error {
-	if err := os.RemoveAll(s.cfg.Out.Path); err != nil {
+func (s *Service) CreatePresets(presetMap *reader.PresetMap, fxChainMap *reader.FXChainMap) error {
+	plan, err := s.Plan(presetMap, fxChainMap)
+	if err != nil {
 		return err
 	}
 
-	// Create a buffered channel for errors
-	errs := make(chan error, runtime.NumCPU())
+	return s.Apply(plan)
+}
 
-	// Create a WaitGroup
-	var wg sync.WaitGroup
+// Package is a preset package built in memory.
+type Package struct {
+	// Path is relative to the output directory
+	Path string
+	// Data is the complete package archive
+	Data []byte
+}
+
+// BuildPreset builds the packages of a single preset without planning or writing them. Depending on the FX chain mode
+// the .instrument is followed by a .multipreset of its inserts.
+func (s *Service) BuildPreset(preset *reader.PresetMapEntry) ([]*Package, error) {
+	staged, err := s.buildPreset(preset)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []*Package
+	for _, pkg := range staged {
+		packages = append(packages, &Package{Path: pkg.Path, Data: pkg.Data})
+	}
+
+	return packages, nil
+}
+
+// BuildFXChain builds the .multipreset of a standalone FX chain without planning or writing it.
+func (s *Service) BuildFXChain(fxChain *reader.FXChainMapEntry) (*Package, error) {
+	pkg, err := s.buildChannelFXChain(fxChain)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Package{Path: pkg.Path, Data: pkg.Data}, nil
+}
 
+// BuildAll builds every preset and FX chain package without planning or writing them. Packages with the same path are
+// given numbered names the way Plan does, the renames are returned as collisions.
+func (s *Service) BuildAll(presetMap *reader.PresetMap, fxChainMap *reader.FXChainMap) ([]*Package, []*Collision, error) {
+	staged, err := s.buildPackages(presetMap, fxChainMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sortPackages(staged)
+
+	collisions, err := s.dedupePaths(staged, "", nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	packages := make([]*Package, 0, len(staged))
+	for _, pkg := range staged {
+		packages = append(packages, &Package{Path: pkg.Path, Data: pkg.Data})
+	}
+
+	return packages, collisions, nil
+}
+
+type buildJob struct {
+	name  string
+	path  string
+	build func() ([]*stagedPackage, error)
+}
+
+// buildPackages builds every preset and FX chain package in memory without touching the output directory. The
+// packages are built by a pool of cfg.Jobs workers, every failing package is reported in the returned error.
+func (s *Service) buildPackages(presetMap *reader.PresetMap, fxChainMap *reader.FXChainMap) ([]*stagedPackage, error) {
 	if presetMap == nil {
-		return errors.New("PresetMap is nil")
+		return nil, errors.New("PresetMap is nil")
 	}
 
-	// Loop over presets
+	var jobs []*buildJob
+
 	for _, preset := range *presetMap {
-		// Increment the WaitGroup counter
+		p := preset
+		jobs = append(jobs, &buildJob{
+			name: p.Name,
+			path: p.Path,
+			build: func() ([]*stagedPackage, error) {
+				return s.buildPreset(p)
+			},
+		})
+	}
+
+	if fxChainMap != nil {
+		for _, fxChain := range *fxChainMap {
+			c := fxChain
+			jobs = append(jobs, &buildJob{
+				name: c.Name,
+				path: c.Path,
+				build: func() ([]*stagedPackage, error) {
+					fxChain, err := s.buildChannelFXChain(c)
+					if err != nil {
+						return nil, err
+					}
+					return []*stagedPackage{fxChain}, nil
+				},
+			})
+		}
+	}
+
+	queue := make(chan *buildJob)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var packages []*stagedPackage
+	var errs []error
+
+	for i := 0; i < s.cfg.Jobs; i++ {
 		wg.Add(1)
 
-		// Start a new goroutine
-		go func(p reader.PresetMapEntry) {
-			err := s.createPreset(&p)
+		go func() {
+			defer wg.Done()
 
-			// If there was an error, send it on the errs channel
-			if err != nil {
-				errs <- err
+			for job := range queue {
+				built, err := job.build()
+
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", path.Join(job.path, job.name), err))
+				} else {
+					packages = append(packages, built...)
+				}
+				mu.Unlock()
 			}
+		}()
+	}
 
-			// Decrement the WaitGroup counter
-			wg.Done()
-		}(*preset)
+	// Stop handing out work once the context is cancelled, the workers finish what they started
+	for _, job := range jobs {
+		if s.ctx.Err() != nil {
+			break
+		}
+		queue <- job
 	}
+	close(queue)
 
-	// Wait for all goroutines to finish
 	wg.Wait()
 
-	// Close the errs channel
-	close(errs)
+	if err := s.ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return packages, nil
+}
+
+func (s *Service) buildPreset(preset *reader.PresetMapEntry) ([]*stagedPackage, error) {
+	// Read raw preset file
+	blob, err := fs.ReadFile(s.song, path.Join("Presets", "Synths", preset.FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []file.ArchiveEntry{{Name: preset.FileName, Data: blob}}
 
-	// Check if there were any errors
-	for err := range errs {
+	if s.cfg.FXChainMode == config.FXChainModeCombined {
+		insertEntries, err := s.readInserts(preset.Inserts)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		entries = append(entries, insertEntries...)
+	}
+
+	dir, name, err := s.presetLocation(preset)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	instrument, err := s.stage(
+		path.Join(dir, fmt.Sprintf("%s.instrument", sanitize.Name(name, s.cfg.ASCIINames))),
+		s.buildMetaInfo(preset, name),
+		s.buildPresetParts(preset),
+		entries,
+	)
+	if err != nil {
+		return nil, err
+	}
+	instrument.SongID = preset.SongID
+	instrument.TrackID = preset.TrackID
+
+	packages := []*stagedPackage{instrument}
+
+	if s.cfg.FXChainMode == config.FXChainModeMultipreset && len(preset.Inserts) > 0 {
+		fxChain, err := s.buildFXChain(preset.SongID, preset.TrackID, name, dir, preset.Inserts)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, fxChain)
+	}
+
+	return packages, nil
 }
 
-func (s *Service) createPreset(preset *reader.PresetMapEntry) error {
-	// Create preset dir
-	if err := os.MkdirAll(path.Join(s.cfg.Temp.PresetConstructionPath, preset.SongID), os.ModeTemporary); err != nil {
-		return err
+// buildChannelFXChain packages the inserts of a mixer channel as a standalone FX chain, placed and named through the
+// same templates as presets.
+func (s *Service) buildChannelFXChain(fxChain *reader.FXChainMapEntry) (*stagedPackage, error) {
+	dir, name, err := s.fxChainLocation(fxChain)
+	if err != nil {
+		return nil, err
 	}
 
-	// Copy raw preset file
-	if err := file.Copy(
-		path.Join(s.cfg.Temp.SongContentsPath, "Presets", "Synths", preset.FileName),
-		path.Join(s.cfg.Temp.PresetConstructionPath, preset.SongID, preset.FileName),
-	); err != nil {
-		return err
+	return s.buildFXChain(fxChain.ChannelID, "", name, dir, fxChain.Inserts)
+}
+
+// buildFXChain packages a chain of insert presets as a .multipreset next to the other presets in presetPath.
+func (s *Service) buildFXChain(id string, trackID string, name string, presetPath string, inserts []*reader.InsertMapEntry) (*stagedPackage, error) {
+	entries, err := s.readInserts(inserts)
+	if err != nil {
+		return nil, err
 	}
 
-	metaInfoContent := s.buildMetaInfo(preset)
-	if err := file.WriteXML(metaInfoContent, path.Join(s.cfg.Temp.PresetConstructionPath, preset.SongID, "metainfo.xml")); err != nil {
-		return err
+	fxChain, err := s.stage(
+		path.Join(sanitize.Path(presetPath, s.cfg.ASCIINames), fmt.Sprintf("%s.multipreset", sanitize.Name(name, s.cfg.ASCIINames))),
+		s.buildFXChainMetaInfo(name),
+		&PresetParts{PresetPart: s.buildInsertParts(inserts)},
+		entries,
+	)
+	if err != nil {
+		return nil, err
 	}
+	fxChain.SongID = id
+	fxChain.TrackID = trackID
 
-	presetPartsContent := s.buildPresetParts(preset)
-	if err := file.WriteXML(presetPartsContent, path.Join(s.cfg.Temp.PresetConstructionPath, preset.SongID, "presetparts.xml")); err != nil {
-		return err
+	return fxChain, nil
+}
+
+// stage builds a package in memory from its metadata and the raw preset data files.
+func (s *Service) stage(packagePath string, metaInfoContent *MetaInfo, presetPartsContent *PresetParts, dataFiles []file.ArchiveEntry) (*stagedPackage, error) {
+	metaInfoXML, err := file.MarshalXML(metaInfoContent)
+	if err != nil {
+		return nil, err
 	}
 
-	normalizedName := strings.ReplaceAll(preset.Name, "\"", " inch")
-	if err := file.Compress(
-		s.ctx, path.Join(s.cfg.Temp.PresetConstructionPath, preset.SongID),
-		path.Join(s.cfg.Out.Path, preset.Path),
-		fmt.Sprintf("%s.instrument", normalizedName),
-	); err != nil {
-		return err
+	presetPartsXML, err := file.MarshalXML(presetPartsContent)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := append([]file.ArchiveEntry{}, dataFiles...)
+	entries = append(entries,
+		file.ArchiveEntry{Name: "metainfo.xml", Data: metaInfoXML},
+		file.ArchiveEntry{Name: "presetparts.xml", Data: presetPartsXML},
+	)
+
+	data, err := file.CompressEntries(entries)
+	if err != nil {
+		return nil, err
 	}
 
-	s.logger.Info(fmt.Sprintf("Created %s", fmt.Sprintf("%s/%s.instrument", preset.Path, normalizedName)))
+	// The archive itself differs on every run by its timestamps, so the hash covers the name and content of every entry
+	contents := make([][]byte, 0, 2*len(entries))
+	for _, entry := range entries {
+		contents = append(contents, []byte(entry.Name+"\x00"), entry.Data)
+	}
+
+	return &stagedPackage{
+		Path: packagePath,
+		Data: data,
+		Hash: file.Hash(contents...),
+	}, nil
+}
+
+func (s *Service) readInserts(inserts []*reader.InsertMapEntry) ([]file.ArchiveEntry, error) {
+	entries := make([]file.ArchiveEntry, 0, len(inserts))
+
+	for _, insert := range inserts {
+		blob, err := fs.ReadFile(s.song, path.Join("Presets", "Effects", insert.PresetFileName))
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, file.ArchiveEntry{Name: insert.PresetFileName, Data: blob})
+	}
 
-	return nil
+	return entries, nil
 }
 
-func (s *Service) buildMetaInfo(preset *reader.PresetMapEntry) *metaInfo {
-	return &metaInfo{
-		Attributes: []metaAttribute{
+func (s *Service) buildMetaInfo(preset *reader.PresetMapEntry, title string) *MetaInfo {
+	return &MetaInfo{
+		Attributes: []MetaAttribute{
 			{
 				ID:    "Class:ID",
 				Value: preset.DeviceClassID,
@@ -168,11 +378,11 @@ func (s *Service) buildMetaInfo(preset *reader.PresetMapEntry) *metaInfo {
 			},
 			{
 				ID:    "Document:Title",
-				Value: preset.Name,
+				Value: title,
 			},
 			{
 				ID:    "Document:Creator",
-				Value: "Studio One Preset Tool",
+				Value: s.creator(),
 			},
 			{
 				ID:    "Document:Generator",
@@ -182,51 +392,120 @@ func (s *Service) buildMetaInfo(preset *reader.PresetMapEntry) *metaInfo {
 	}
 }
 
-func (s *Service) buildPresetParts(preset *reader.PresetMapEntry) *presetParts {
-	return &presetParts{
-		PresetPart: []struct {
-			Attributes []metaAttribute `xml:"Attribute"`
-		}{
-			{
-				Attributes: []metaAttribute{
-					{
-						ID:    "Class:ID",
-						Value: preset.DeviceClassID,
-					},
-					{
-						ID:    "Class:Name",
-						Value: preset.DeviceBaseName,
-					},
-					{
-						ID:    "Class:Category",
-						Value: preset.DeviceCategory,
-					},
-					{
-						ID:    "Class:SubCategory",
-						Value: preset.DeviceSubCategory,
-					},
-					{
-						ID:    "DeviceSlot:deviceName",
-						Value: preset.DeviceName,
-					},
-					{
-						ID:    "DeviceSlot:deviceUID",
-						Value: preset.DeviceUID,
-					},
-					{
-						ID:    "DeviceSlot:slotUID",
-						Value: preset.TrackID,
-					},
-					{
-						ID:    "AudioSynth:IsMainPreset",
-						Value: "1",
-					},
-					{
-						ID:    "Preset:DataFile",
-						Value: preset.FileName,
-					},
+func (s *Service) buildPresetParts(preset *reader.PresetMapEntry) *PresetParts {
+	parts := []PresetPart{
+		{
+			Attributes: []MetaAttribute{
+				{
+					ID:    "Class:ID",
+					Value: preset.DeviceClassID,
+				},
+				{
+					ID:    "Class:Name",
+					Value: preset.DeviceBaseName,
+				},
+				{
+					ID:    "Class:Category",
+					Value: preset.DeviceCategory,
+				},
+				{
+					ID:    "Class:SubCategory",
+					Value: preset.DeviceSubCategory,
+				},
+				{
+					ID:    "DeviceSlot:deviceName",
+					Value: preset.DeviceName,
 				},
+				{
+					ID:    "DeviceSlot:deviceUID",
+					Value: preset.DeviceUID,
+				},
+				{
+					ID:    "DeviceSlot:slotUID",
+					Value: preset.TrackID,
+				},
+				{
+					ID:    "AudioSynth:IsMainPreset",
+					Value: "1",
+				},
+				{
+					ID:    "Preset:DataFile",
+					Value: preset.FileName,
+				},
+			},
+		},
+	}
+
+	if s.cfg.FXChainMode == config.FXChainModeCombined {
+		parts = append(parts, s.buildInsertParts(preset.Inserts)...)
+	}
+
+	return &PresetParts{PresetPart: parts}
+}
+
+func (s *Service) buildFXChainMetaInfo(name string) *MetaInfo {
+	return &MetaInfo{
+		Attributes: []MetaAttribute{
+			{
+				ID:    "Document:Title",
+				Value: name,
+			},
+			{
+				ID:    "Document:Creator",
+				Value: s.creator(),
+			},
+			{
+				ID:    "Document:Generator",
+				Value: "Studio One Preset Tool",
 			},
 		},
 	}
 }
+
+func (s *Service) buildInsertParts(inserts []*reader.InsertMapEntry) []PresetPart {
+	parts := make([]PresetPart, 0, len(inserts))
+
+	for _, insert := range inserts {
+		parts = append(parts, PresetPart{
+			Attributes: []MetaAttribute{
+				{
+					ID:    "Class:ID",
+					Value: insert.DeviceClassID,
+				},
+				{
+					ID:    "Class:Name",
+					Value: insert.DeviceBaseName,
+				},
+				{
+					ID:    "Class:Category",
+					Value: insert.DeviceCategory,
+				},
+				{
+					ID:    "Class:SubCategory",
+					Value: insert.DeviceSubCategory,
+				},
+				{
+					ID:    "DeviceSlot:deviceName",
+					Value: insert.DeviceName,
+				},
+				{
+					ID:    "DeviceSlot:deviceUID",
+					Value: insert.DeviceUID,
+				},
+				{
+					ID:    "Preset:DataFile",
+					Value: insert.PresetFileName,
+				},
+			},
+		})
+	}
+
+	return parts
+}
+
+func (s *Service) creator() string {
+	if s.cfg.Creator == "" {
+		return config.DefaultCreator
+	}
+	return s.cfg.Creator
+}
@@ -0,0 +1,40 @@
+package writer
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"testing"
+)
+
+func TestStageHash(t *testing.T) {
+	s := newTestService(t, t.TempDir())
+	preset := &reader.PresetMapEntry{DeviceName: "Mai Tai", FileName: "Mai Tai.preset"}
+	dataFiles := []file.ArchiveEntry{{Name: "Mai Tai.preset", Data: []byte("state")}}
+
+	hash := func() string {
+		t.Helper()
+
+		pkg, err := s.stage("Lead.instrument", s.buildMetaInfo(preset, "Lead"), s.buildPresetParts(preset), dataFiles)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pkg.Hash
+	}
+
+	original := hash()
+	if hash() != original {
+		t.Error("Staging the same package twice gave different hashes")
+	}
+
+	// Metadata changes must be written back, not only changes to the preset data
+	s.cfg.Creator = "Jane"
+	creator := hash()
+	if creator == original {
+		t.Error("Changing the creator did not change the hash")
+	}
+
+	preset.DeviceName = "Mai Tai 2"
+	if hash() == creator {
+		t.Error("Changing the device name did not change the hash")
+	}
+}
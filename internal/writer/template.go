@@ -0,0 +1,103 @@
+package writer
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/config"
+	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"bholtland/studio-one-preset-tool-go/internal/sanitize"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+)
+
+var (
+	defaultNameTemplate = template.Must(template.New("name").Parse(config.DefaultNameTemplate))
+	defaultPathTemplate = template.Must(template.New("path").Parse(config.DefaultPathTemplate))
+)
+
+// presetTemplateData is what the name and path templates are executed with: every field of the preset, plus the song
+// it comes from.
+type presetTemplateData struct {
+	*reader.PresetMapEntry
+	// Song is the file name of the song without its extension
+	Song string
+}
+
+// presetLocation renders the folder, relative to the output directory, and the name of the packages of a preset. The
+// folder is sanitized for use on any file system, the name is returned as rendered for use as the preset title.
+func (s *Service) presetLocation(preset *reader.PresetMapEntry) (string, string, error) {
+	data := &presetTemplateData{
+		PresetMapEntry: preset,
+		Song:           s.songName(),
+	}
+
+	nameTemplate := s.cfg.NameTemplate
+	if nameTemplate == nil {
+		nameTemplate = defaultNameTemplate
+	}
+	pathTemplate := s.cfg.PathTemplate
+	if pathTemplate == nil {
+		pathTemplate = defaultPathTemplate
+	}
+
+	var name strings.Builder
+	if err := nameTemplate.Execute(&name, data); err != nil {
+		return "", "", fmt.Errorf("Error executing name template: %s", err)
+	}
+	if strings.TrimSpace(name.String()) == "" {
+		return "", "", errors.New("The name template produced an empty name")
+	}
+
+	var dir strings.Builder
+	if err := pathTemplate.Execute(&dir, data); err != nil {
+		return "", "", fmt.Errorf("Error executing path template: %s", err)
+	}
+
+	cleanDir, err := cleanTemplatePath(dir.String())
+	if err != nil {
+		return "", "", err
+	}
+
+	return sanitize.Path(cleanDir, s.cfg.ASCIINames), name.String(), nil
+}
+
+// fxChainLocation renders the folder and name of a standalone FX chain like presetLocation. A chain has no device of
+// its own, the device fields are empty when the templates use them.
+func (s *Service) fxChainLocation(fxChain *reader.FXChainMapEntry) (string, string, error) {
+	return s.presetLocation(&reader.PresetMapEntry{
+		Name:   fxChain.Name,
+		Path:   fxChain.Path,
+		SongID: fxChain.ChannelID,
+	})
+}
+
+// cleanTemplatePath drops the empty segments left by empty fields, such as the path of a track outside any folder.
+// Paths leaving the output directory are rejected.
+func cleanTemplatePath(p string) (string, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(p, "\\", "/"), "/") {
+		segment = strings.TrimSpace(segment)
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("The path template produced %q, which leaves the output directory", p)
+		}
+		segments = append(segments, segment)
+	}
+
+	return path.Join(segments...), nil
+}
+
+func (s *Service) songName() string {
+	if s.cfg.In.Name != "" {
+		return s.cfg.In.Name
+	}
+
+	name := s.cfg.In.FileName
+	if name == "" {
+		name = path.Base(s.cfg.In.Full)
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
@@ -0,0 +1,183 @@
+package studioone
+
+import (
+	"bholtland/studio-one-preset-tool-go/internal/config"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"text/template"
+)
+
+// FXChainMode decides what happens to the insert FX chain of instrument channels.
+type FXChainMode string
+
+const (
+	// FXChainsOff exports instruments without their inserts
+	FXChainsOff FXChainMode = "off"
+	// FXChainsCombined stores the insert presets inside the .instrument package
+	FXChainsCombined FXChainMode = "combined"
+	// FXChainsMultipreset writes the inserts as a .multipreset next to the .instrument
+	FXChainsMultipreset FXChainMode = "multipreset"
+)
+
+// ConflictPolicy decides what Export does with files in the output directory it did not create itself.
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictRename    ConflictPolicy = "rename"
+	ConflictFail      ConflictPolicy = "fail"
+)
+
+type options struct {
+	fxChainMode     FXChainMode
+	channelFXChains bool
+	onConflict      ConflictPolicy
+	prune           bool
+	removeExisting  bool
+	jobs            int
+	logger          *slog.Logger
+	sourceName      string
+	nameTemplate    string
+	pathTemplate    string
+	asciiNames      bool
+	creator         string
+
+	parsedNameTemplate *template.Template
+	parsedPathTemplate *template.Template
+}
+
+// Option configures how a song is read and written.
+type Option func(*options)
+
+// WithFXChains sets how the insert FX chains of instrument channels are exported, FXChainsOff by default.
+func WithFXChains(mode FXChainMode) Option {
+	return func(o *options) {
+		o.fxChainMode = mode
+	}
+}
+
+// WithChannelFXChains also exports the insert FX chains of audio tracks, buses and FX channels.
+func WithChannelFXChains() Option {
+	return func(o *options) {
+		o.channelFXChains = true
+	}
+}
+
+// WithConflictPolicy sets what Export does with existing files it did not create, ConflictRename by default.
+func WithConflictPolicy(policy ConflictPolicy) Option {
+	return func(o *options) {
+		o.onConflict = policy
+	}
+}
+
+// WithPrune makes Export remove packages it created earlier whose track no longer exists.
+func WithPrune() Option {
+	return func(o *options) {
+		o.prune = true
+	}
+}
+
+// WithRemoveExisting makes Export clear the output directory instead of merging into it.
+func WithRemoveExisting() Option {
+	return func(o *options) {
+		o.removeExisting = true
+	}
+}
+
+// WithJobs sets how many packages are built at the same time, the number of CPUs by default.
+func WithJobs(jobs int) Option {
+	return func(o *options) {
+		o.jobs = jobs
+	}
+}
+
+// WithLogger sets the logger that receives progress and skipped tracks, nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithSourceName sets the name Export records the song under in the output directory, so presets of several songs
+// can share it. Open uses the absolute path of the song by default, like the command line, the other constructors
+// "song".
+func WithSourceName(name string) Option {
+	return func(o *options) {
+		o.sourceName = name
+	}
+}
+
+// WithNameTemplate sets the Go template the package file names are built from, "{{.Name}}" by default. Templates are
+// executed with the fields of the preset and {{.Song}}, the song file name.
+func WithNameTemplate(nameTemplate string) Option {
+	return func(o *options) {
+		o.nameTemplate = nameTemplate
+	}
+}
+
+// WithPathTemplate sets the Go template the folder of each package is built from, "{{.Path}}" by default.
+func WithPathTemplate(pathTemplate string) Option {
+	return func(o *options) {
+		o.pathTemplate = pathTemplate
+	}
+}
+
+// WithASCIINames transliterates file and folder names to plain ASCII.
+func WithASCIINames() Option {
+	return func(o *options) {
+		o.asciiNames = true
+	}
+}
+
+// WithCreator sets the creator stored in the metadata of every package, "Studio One Preset Tool" by default.
+func WithCreator(creator string) Option {
+	return func(o *options) {
+		o.creator = creator
+	}
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		fxChainMode:  FXChainsOff,
+		onConflict:   ConflictRename,
+		jobs:         runtime.NumCPU(),
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		nameTemplate: config.DefaultNameTemplate,
+		pathTemplate: config.DefaultPathTemplate,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	switch o.fxChainMode {
+	case FXChainsOff, FXChainsCombined, FXChainsMultipreset:
+	default:
+		return nil, fmt.Errorf("Unknown FX chain mode %q", o.fxChainMode)
+	}
+
+	switch o.onConflict {
+	case ConflictSkip, ConflictOverwrite, ConflictRename, ConflictFail:
+	default:
+		return nil, fmt.Errorf("Unknown conflict policy %q", o.onConflict)
+	}
+
+	if o.jobs < 1 {
+		return nil, fmt.Errorf("Invalid number of jobs %d", o.jobs)
+	}
+
+	var err error
+	o.parsedNameTemplate, err = template.New("name").Option("missingkey=error").Parse(o.nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid name template: %s", err)
+	}
+	o.parsedPathTemplate, err = template.New("path").Option("missingkey=error").Parse(o.pathTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid path template: %s", err)
+	}
+
+	return o, nil
+}
@@ -0,0 +1,329 @@
+// Package studioone extracts the instrument presets of Studio One songs and writes them as .instrument packages.
+//
+//	song, err := studioone.Open("Instrument Exploration.song", studioone.WithFXChains(studioone.FXChainsCombined))
+//	if err != nil {
+//		return err
+//	}
+//	defer song.Close()
+//
+//	result, err := song.Export(ctx, "Presets")
+package studioone
+
+import (
+	"archive/zip"
+	"bholtland/studio-one-preset-tool-go/internal/config"
+	"bholtland/studio-one-preset-tool-go/internal/file"
+	"bholtland/studio-one-preset-tool-go/internal/reader"
+	"bholtland/studio-one-preset-tool-go/internal/writer"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// Song is an opened Studio One song.
+type Song struct {
+	fsys   fs.FS
+	closer io.Closer
+	opts   *options
+}
+
+// Preset is an instrument preset found in a song.
+type Preset struct {
+	// Name is the name of the track, the package is named after it
+	Name string
+	// Path is the slash separated folder path of the track
+	Path              string
+	TrackID           string
+	ChannelID         string
+	DeviceName        string
+	DeviceBaseName    string
+	DeviceClassID     string
+	DeviceCategory    string
+	DeviceSubCategory string
+
+	song  *Song
+	entry *reader.PresetMapEntry
+}
+
+// Skip explains why a part of the song did not become a preset.
+type Skip struct {
+	Reason      string
+	Description string
+	TrackName   string
+	DeviceName  string
+	// Node names the XML file and element the problem was found in
+	Node string
+}
+
+// Result lists the files Export touched, relative to the output directory.
+type Result struct {
+	Created     []string
+	Overwritten []string
+	Unchanged   []string
+	Skipped     []string
+	Deleted     []string
+	// Renamed lists the presets that were given a numbered name because their path was already used
+	Renamed []*Rename
+}
+
+// Rename is a preset written to To instead of From, as another preset or file already used From.
+type Rename struct {
+	From   string
+	To     string
+	Reason string
+}
+
+// Destination receives the packages written by WriteAll. The name is the slash separated path of the package.
+type Destination interface {
+	WriteFile(name string, data []byte) error
+}
+
+// DirDestination writes packages below a directory on disk, creating folders as needed.
+type DirDestination string
+
+func (d DirDestination) WriteFile(name string, data []byte) error {
+	filePath := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+	return file.WriteFileAtomic(filePath, data)
+}
+
+// Open opens a song file or an extracted song directory. The song has to be closed when done.
+func Open(songPath string, opts ...Option) (*Song, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	// The absolute path is what the command line records, so both see the same song in a shared output directory
+	if o.sourceName == "" {
+		absPath, err := filepath.Abs(songPath)
+		if err != nil {
+			return nil, fmt.Errorf("Error opening project: %s", err)
+		}
+		o.sourceName = filepath.ToSlash(absPath)
+	}
+
+	song, err := file.OpenSong(songPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening project: %s", err)
+	}
+
+	return &Song{fsys: song, closer: song, opts: o}, nil
+}
+
+// OpenReader reads a song from the contents of a song file, such as a download held in memory.
+func OpenReader(r io.ReaderAt, size int64, opts ...Option) (*Song, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening project: %s", err)
+	}
+
+	return OpenFS(archive, opts...)
+}
+
+// OpenFS reads a song from a file system laid out like a song archive, such as an extracted song directory.
+func OpenFS(fsys fs.FS, opts ...Option) (*Song, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if o.sourceName == "" {
+		o.sourceName = "song"
+	}
+
+	return &Song{fsys: fsys, opts: o}, nil
+}
+
+// Close releases the song file opened by Open.
+func (s *Song) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// Presets returns the instrument presets of the song sorted by path and name, together with everything that was
+// skipped.
+func (s *Song) Presets() ([]*Preset, []*Skip, error) {
+	presetMap, skips, err := reader.NewService(s.config(""), s.fsys).GetPresets()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing: %s", err)
+	}
+
+	var presets []*Preset
+	for _, entry := range presetMap {
+		presets = append(presets, &Preset{
+			Name:              entry.Name,
+			Path:              entry.Path,
+			TrackID:           entry.TrackID,
+			ChannelID:         entry.SongID,
+			DeviceName:        entry.DeviceName,
+			DeviceBaseName:    entry.DeviceBaseName,
+			DeviceClassID:     entry.DeviceClassID,
+			DeviceCategory:    entry.DeviceCategory,
+			DeviceSubCategory: entry.DeviceSubCategory,
+			song:              s,
+			entry:             entry,
+		})
+	}
+
+	sort.Slice(presets, func(i, j int) bool {
+		return path.Join(presets[i].Path, presets[i].Name) < path.Join(presets[j].Path, presets[j].Name)
+	})
+
+	return presets, convertSkips(skips), nil
+}
+
+// WriteTo writes the .instrument package of the preset to w.
+func (p *Preset) WriteTo(w io.Writer) (int64, error) {
+	packages, err := p.song.writer(context.Background(), "").BuildPreset(p.entry)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(packages[0].Data)
+	return int64(n), err
+}
+
+// WriteAll builds every package of the song and hands it to dst. Unlike Export nothing is merged, existing packages
+// are simply replaced.
+func (s *Song) WriteAll(ctx context.Context, dst Destination) error {
+	cfg := s.config("")
+	readerSvc := reader.NewService(cfg, s.fsys)
+	writerSvc := s.writer(ctx, "")
+
+	presetMap, _, err := readerSvc.GetPresets()
+	if err != nil {
+		return fmt.Errorf("Error parsing: %s", err)
+	}
+
+	var fxChainMap *reader.FXChainMap
+	if cfg.ChannelFXChains {
+		channelFXChains, _, err := readerSvc.GetFXChains()
+		if err != nil {
+			return fmt.Errorf("Error parsing FX chains: %s", err)
+		}
+		fxChainMap = &channelFXChains
+	}
+
+	// Presets with the same name get numbered names instead of overwriting each other in dst
+	packages, _, err := writerSvc.BuildAll(&presetMap, fxChainMap)
+	if err != nil {
+		return fmt.Errorf("Error building presets: %s", err)
+	}
+
+	for _, pkg := range packages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := dst.WriteFile(pkg.Path, pkg.Data); err != nil {
+			return fmt.Errorf("Error writing %s: %s", pkg.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// Export writes the packages of the song to a directory the way the command line tool does: packages are merged into
+// the directory according to the conflict policy and recorded so later exports can update or prune them.
+func (s *Song) Export(ctx context.Context, outPath string) (*Result, error) {
+	cfg := s.config(filepath.ToSlash(outPath))
+	readerSvc := reader.NewService(cfg, s.fsys)
+	writerSvc := s.writer(ctx, cfg.Out.Path)
+
+	presetMap, skips, err := readerSvc.GetPresets()
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing: %s", err)
+	}
+
+	var fxChainMap *reader.FXChainMap
+	if cfg.ChannelFXChains {
+		channelFXChains, fxChainSkips, err := readerSvc.GetFXChains()
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing FX chains: %s", err)
+		}
+		fxChainMap = &channelFXChains
+		skips = append(skips, fxChainSkips...)
+	}
+
+	skips.Log(s.opts.logger)
+
+	plan, err := writerSvc.Plan(&presetMap, fxChainMap)
+	if err != nil {
+		return nil, fmt.Errorf("Error planning presets: %s", err)
+	}
+
+	if err := writerSvc.Apply(plan); err != nil {
+		return nil, fmt.Errorf("Error writing presets: %s", err)
+	}
+
+	result := &Result{}
+	for _, action := range plan.Actions {
+		switch action.Kind {
+		case writer.ActionCreate:
+			result.Created = append(result.Created, action.Path)
+		case writer.ActionOverwrite:
+			result.Overwritten = append(result.Overwritten, action.Path)
+		case writer.ActionUnchanged:
+			result.Unchanged = append(result.Unchanged, action.Path)
+		case writer.ActionSkip:
+			result.Skipped = append(result.Skipped, action.Path)
+		case writer.ActionDelete:
+			result.Deleted = append(result.Deleted, action.Path)
+		}
+	}
+
+	for _, collision := range plan.Collisions {
+		result.Renamed = append(result.Renamed, &Rename{
+			From:   collision.Path,
+			To:     collision.RenamedTo,
+			Reason: collision.Reason(),
+		})
+	}
+
+	return result, nil
+}
+
+// config translates the options to the configuration the reader and writer work with.
+func (s *Song) config(outPath string) *config.Config {
+	cfg := &config.Config{
+		RemoveExistingOut: s.opts.removeExisting,
+		FXChainMode:       config.FXChainMode(s.opts.fxChainMode),
+		ChannelFXChains:   s.opts.channelFXChains,
+		OnConflict:        config.ConflictPolicy(s.opts.onConflict),
+		Prune:             s.opts.prune,
+		Jobs:              s.opts.jobs,
+		NameTemplate:      s.opts.parsedNameTemplate,
+		PathTemplate:      s.opts.parsedPathTemplate,
+		ASCIINames:        s.opts.asciiNames,
+		Creator:           s.opts.creator,
+	}
+	cfg.In.Full = s.opts.sourceName
+	cfg.Out.Path = outPath
+
+	return cfg
+}
+
+func (s *Song) writer(ctx context.Context, outPath string) *writer.Service {
+	return writer.NewService(s.config(outPath), ctx, s.opts.logger, s.fsys)
+}
+
+func convertSkips(skips reader.Skips) []*Skip {
+	var converted []*Skip
+	for _, skip := range skips {
+		converted = append(converted, &Skip{
+			Reason:      string(skip.Reason),
+			Description: skip.Description(),
+			TrackName:   skip.TrackName,
+			DeviceName:  skip.DeviceName,
+			Node:        skip.Node,
+		})
+	}
+	return converted
+}